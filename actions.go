@@ -0,0 +1,1114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	workflowMarkdown = template.Must(template.New("workflow").Funcs(funcMap).Parse(
+		`# Workflow {{ .Workflow.Name }}
+
+* Path: {{ .Workflow.Path }}
+* State: {{ .Workflow.State }}
+* URL: {{ .Workflow.HTMLURL }}
+
+## Recent runs
+
+{{ range .Runs }}  * [{{ .ID }}](../runs/{{ .ID }}/run.md) #{{ .RunNumber }} {{ .Event }} on {{ .HeadBranch }} - {{ .Status }}{{ if .Conclusion }} {{ .Conclusion }}{{ end }} - {{ .CreatedAt.Format "2006-01-02T15:04:05Z07:00" }}
+{{ else }}There are no runs of this workflow.
+{{ end }}
+## Dispatch
+
+Workflows with a workflow_dispatch trigger can be run by hand. Fill in the branch or tag to run
+it on and its inputs, one "name: value" on each line, then check Dispatch and save this file.
+
+* {{ markform .Form "Ref" }}
+
+{{ markform .Form "Inputs" }}
+
+* {{ markform .Form "Dispatch" }}
+`))
+
+	runMarkdown = template.Must(template.New("run").Funcs(funcMap).Parse(
+		`# Run {{ .Run.ID }}
+
+{{ .Run.Name }} #{{ .Run.RunNumber }}{{ if .Run.DisplayTitle }} - {{ .Run.DisplayTitle }}{{ end }}
+
+* Status: {{ .Run.Status }}
+* Conclusion: {{ .Run.Conclusion }}
+* Trigger: {{ .Run.Event }} by {{ .Run.Actor.Login }}
+* Branch: {{ .Run.HeadBranch }}
+* Commit: [{{ .Run.HeadSHA }}](../../../commits/{{ .Run.HeadSHA }}.md)
+* Started: {{ .Run.Started.Format "2006-01-02T15:04:05Z07:00" }}
+* Duration: {{ .Run.Duration }}
+* Attempt: {{ .Run.RunAttempt }}
+* URL: {{ .Run.HTMLURL }}
+
+## Jobs
+
+{{ range .Jobs }}  * [{{ .Name }}](jobs/{{ .LogName }}) - {{ .Status }}{{ if .Conclusion }} {{ .Conclusion }}{{ end }} - {{ .Duration }}
+{{ else }}There are no jobs in this run.
+{{ end }}
+## Artifacts
+
+{{ range .Artifacts }}  * [{{ .FileName }}](artifacts/{{ .FileName }}) - {{ .SizeInBytes }} bytes{{ if .Expired }} (expired){{ end }}
+{{ else }}There are no artifacts.
+{{ end }}
+## Actions
+
+Choose an action and save this file to rerun all of the jobs, rerun only the jobs that failed or
+cancel the run.
+
+* {{ markform .Form "Action" }}
+`))
+
+	// jobLogPattern matches the log of a whole job in the logs
+	//  archive of a run, the logs of the steps are in directories.
+	jobLogPattern = regexp.MustCompile(`^[0-9]+_([^/]+)\.txt$`)
+)
+
+// workflow is a GitHub Actions workflow, which go-github doesn't
+//  have yet like the rest of the actions.
+type workflow struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+}
+
+// FileName is the name of the markform file of the workflow
+func (w *workflow) FileName() string {
+	base := path.Base(w.Path)
+	return strings.TrimSuffix(base, path.Ext(base)) + ".md"
+}
+
+// workflowRun is a run of a workflow
+type workflowRun struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	DisplayTitle string    `json:"display_title"`
+	RunNumber    int       `json:"run_number"`
+	RunAttempt   int       `json:"run_attempt"`
+	Event        string    `json:"event"`
+	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion"`
+	HeadBranch   string    `json:"head_branch"`
+	HeadSHA      string    `json:"head_sha"`
+	HTMLURL      string    `json:"html_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	RunStartedAt time.Time `json:"run_started_at"`
+	Actor        struct {
+		Login string `json:"login"`
+	} `json:"actor"`
+}
+
+// Started is when the run started, or when it was created for the
+//  runs that don't say.
+func (r *workflowRun) Started() time.Time {
+	if r.RunStartedAt.IsZero() {
+		return r.CreatedAt
+	}
+	return r.RunStartedAt
+}
+
+// Duration is how long the run took, or has taken so far
+func (r *workflowRun) Duration() time.Duration {
+	if r.Status == "completed" {
+		return r.UpdatedAt.Sub(r.Started()).Round(time.Second)
+	}
+	return time.Since(r.Started()).Round(time.Second)
+}
+
+// workflowJob is a job of a workflow run
+type workflowJob struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// LogName is the name of the log file of the job
+func (j *workflowJob) LogName() string {
+	return refFileName(j.Name) + ".log"
+}
+
+// Duration is how long the job took, or has taken so far
+func (j *workflowJob) Duration() time.Duration {
+	if j.StartedAt.IsZero() {
+		return 0
+	}
+	if j.CompletedAt.IsZero() {
+		return time.Since(j.StartedAt).Round(time.Second)
+	}
+	return j.CompletedAt.Sub(j.StartedAt).Round(time.Second)
+}
+
+// artifact is a file that a workflow run uploaded
+type artifact struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+	Expired     bool   `json:"expired"`
+}
+
+// FileName is the name of the zip file of the artifact
+func (a *artifact) FileName() string {
+	return refFileName(a.Name) + ".zip"
+}
+
+// splitActionsPath splits the owner and repo from the name of a file
+//  in the actions directory of a repository.
+func splitActionsPath(name string) (string, string) {
+	parts := strings.SplitN(name, "/", 5)
+	return parts[2], parts[3]
+}
+
+// actionsLink finds where to download the logs or an artifact, which
+//  GitHub redirects to. The redirect isn't followed since the link
+//  doesn't take the API token. A nil link means that it's gone.
+func actionsLink(u string) (*url.URL, error) {
+	req, err := uncachedClient.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := apiTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusFound:
+		return url.Parse(resp.Header.Get("Location"))
+	case http.StatusNotFound, http.StatusGone:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("Finding %s failed: %s", u, resp.Status)
+}
+
+// NewActionsHandler adds the actions directory of a repository with
+//  its workflows and runs.
+func NewActionsHandler(repoPath string) {
+	actionsPath := path.Join(repoPath, "actions")
+	server.AddFileEntry(actionsPath, &dynamic.BasicDirHandler{server, nil})
+	NewWorkflowsHandler(path.Join(actionsPath, "workflows"))
+	NewRunsHandler(path.Join(actionsPath, "runs"))
+}
+
+// WorkflowsHandler handles the workflows directory with a markform
+//  file for each workflow.
+type WorkflowsHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewWorkflowsHandler(workflowsPath string) {
+	handler := &WorkflowsHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(workflowsPath, handler)
+}
+
+func (wh *WorkflowsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := wh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		err = wh.refresh(name)
+		if err != nil {
+			return -1, err
+		}
+		return wh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (wh *WorkflowsHandler) refresh(name string) error {
+	owner, repo := splitActionsPath(name)
+	filter := make(map[string]bool)
+
+	log.Printf("Listing the workflows of %s/%s\n", owner, repo)
+	workflows := struct {
+		Workflows []*workflow `json:"workflows"`
+	}{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/workflows?per_page=100", owner, repo), nil, &workflows)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workflows.Workflows {
+		workflowPath := path.Join(name, strings.TrimSuffix(w.FileName(), ".md"))
+		NewWorkflowHandler(workflowPath, w.ID)
+		filter[workflowPath+".md"] = true
+		filter[workflowPath+".json"] = true
+	}
+
+	wh.mu.Lock()
+	wh.filter = filter
+	wh.mu.Unlock()
+
+	return nil
+}
+
+func (wh *WorkflowsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := wh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return wh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// WorkflowForm dispatches a workflow on a ref with its inputs, which
+//  are written as "name: value" on each line.
+type WorkflowForm struct {
+	Ref      string ` = ___`
+	Inputs   string ` = <<<`
+	Dispatch bool   ` = []`
+}
+
+// inputs reads the inputs of the workflow from the form
+func (f *WorkflowForm) inputs() (map[string]string, error) {
+	inputs := make(map[string]string)
+	for _, line := range strings.Split(f.Inputs, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Inputs are written as name: value, not %s", line)
+		}
+		inputs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return inputs, nil
+}
+
+// WorkflowHandler handles the markform file of a workflow with its
+//  recent runs and a form to dispatch it.
+type WorkflowHandler struct {
+	Workflow *workflow
+	Runs     []*workflowRun
+	Form     WorkflowForm
+
+	id       int64
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewWorkflowHandler(workflowPath string, id int64) {
+	handler := &WorkflowHandler{id: id, readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(workflowPath+".md", handler)
+	NewFormJSONHandler(workflowPath+".json", handler)
+}
+
+func (wh *WorkflowHandler) load(owner string, repo string) error {
+	log.Printf("Reading workflow %d of %s/%s\n", wh.id, owner, repo)
+	w := &workflow{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/workflows/%d", owner, repo, wh.id), nil, w)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Listing the runs of workflow %d of %s/%s\n", wh.id, owner, repo)
+	runs := struct {
+		WorkflowRuns []*workflowRun `json:"workflow_runs"`
+	}{}
+	err = apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/workflows/%d/runs?per_page=10", owner, repo, wh.id), nil, &runs)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reading repo %s/%s\n", owner, repo)
+	r, _, err := client.Repositories.Get(context.Background(), owner, repo)
+	if err != nil {
+		return err
+	}
+
+	wh.Workflow = w
+	wh.Runs = runs.WorkflowRuns
+	wh.Form = WorkflowForm{Ref: r.GetDefaultBranch()}
+
+	return nil
+}
+
+func (wh *WorkflowHandler) loadForm(name string) (interface{}, error) {
+	owner, repo := splitActionsPath(name)
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	err := wh.load(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	form := wh.Form
+	return &form, nil
+}
+
+func (wh *WorkflowHandler) saveForm(name string, edited interface{}) error {
+	owner, repo := splitActionsPath(name)
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	return wh.save(owner, repo, edited.(*WorkflowForm))
+}
+
+// save dispatches the workflow when Dispatch is checked
+func (wh *WorkflowHandler) save(owner string, repo string, form *WorkflowForm) error {
+	if !form.Dispatch {
+		return nil
+	}
+
+	inputs, err := form.inputs()
+	if err != nil {
+		return err
+	}
+
+	dispatch := struct {
+		Ref    string            `json:"ref"`
+		Inputs map[string]string `json:"inputs"`
+	}{form.Ref, inputs}
+
+	log.Printf("Dispatching workflow %d of %s/%s on %s\n", wh.id, owner, repo, form.Ref)
+	err = apiRequest("POST", fmt.Sprintf("repos/%s/%s/actions/workflows/%d/dispatches", owner, repo, wh.id), dispatch, nil)
+	if err != nil {
+		return err
+	}
+
+	form.Dispatch = false
+	wh.Form = *form
+
+	return nil
+}
+
+func (wh *WorkflowHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of a workflow")
+}
+
+func (wh *WorkflowHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo := splitActionsPath(name)
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	err := wh.load(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err = workflowMarkdown.Execute(&buf, wh)
+		if err != nil {
+			return err
+		}
+		wh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if wh.writefid != 0 {
+			return fmt.Errorf("Workflow doesn't support concurrent writes")
+		}
+
+		wh.writefid = fid
+		wh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (wh *WorkflowHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if offset >= int64(wh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(wh.readbuf.Len()) {
+		return wh.readbuf.Bytes()[offset:], nil
+	}
+
+	return wh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (wh *WorkflowHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if fid != wh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := wh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (wh *WorkflowHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a workflow is not supported")
+}
+
+func (wh *WorkflowHandler) Stat(name string) (protocol.Dir, error) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(wh.readbuf.Len())}, nil
+}
+
+func (wh *WorkflowHandler) Wstat(name string, dir protocol.Dir) error {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.writebuf != nil {
+		wh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (wh *WorkflowHandler) Remove(name string) error {
+	return fmt.Errorf("Removing workflows isn't supported.")
+}
+
+func (wh *WorkflowHandler) Clunk(name string, fid protocol.FID) error {
+	owner, repo := splitActionsPath(name)
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if fid != wh.writefid {
+		return nil
+	}
+	wh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(wh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &WorkflowForm{}
+	_, err := markform.Diff(&wh.Form, markform.Parse(wh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return wh.save(owner, repo, form)
+}
+
+// RunsHandler handles the runs directory with a directory for each
+//  of the recent workflow runs. Older runs are found by their ID.
+type RunsHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewRunsHandler(runsPath string) {
+	handler := &RunsHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(runsPath, handler)
+}
+
+func (rh *RunsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := rh.BasicDirHandler.WalkChild(name, child)
+
+	if id, e := strconv.ParseInt(child, 10, 64); idx == -1 && e == nil {
+		owner, repo := splitActionsPath(name)
+
+		log.Printf("Checking if run %d of %s/%s exists\n", id, owner, repo)
+		err = apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs/%d", owner, repo, id), nil, &workflowRun{})
+		if err != nil {
+			return -1, err
+		}
+
+		NewRunHandlers(path.Join(name, child), id)
+		rh.mu.Lock()
+		if rh.filter != nil {
+			rh.filter[path.Join(name, child)] = true
+		}
+		rh.mu.Unlock()
+
+		return rh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (rh *RunsHandler) refresh(name string) error {
+	owner, repo := splitActionsPath(name)
+	filter := make(map[string]bool)
+
+	// Only the most recent runs are shown
+	log.Printf("Listing the runs of %s/%s\n", owner, repo)
+	runs := struct {
+		WorkflowRuns []*workflowRun `json:"workflow_runs"`
+	}{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs?per_page=30", owner, repo), nil, &runs)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs.WorkflowRuns {
+		runPath := path.Join(name, strconv.FormatInt(run.ID, 10))
+		NewRunHandlers(runPath, run.ID)
+		filter[runPath] = true
+	}
+
+	rh.mu.Lock()
+	rh.filter = filter
+	rh.mu.Unlock()
+
+	return nil
+}
+
+func (rh *RunsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := rh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return rh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// NewRunHandlers adds the directory of a workflow run with its run.md,
+//  the logs of its jobs and its artifacts.
+func NewRunHandlers(runPath string, id int64) {
+	server.AddFileEntry(runPath, &dynamic.BasicDirHandler{server, nil})
+
+	handler := &RunHandler{id: id, readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(runPath, "run.md"), handler)
+	NewFormJSONHandler(path.Join(runPath, "run.json"), handler)
+
+	NewJobsHandler(path.Join(runPath, "jobs"), id)
+	NewArtifactsHandler(path.Join(runPath, "artifacts"), id)
+}
+
+// RunForm holds the action to take on a workflow run
+type RunForm struct {
+	Action string ` = () none () rerun () rerun-failed () cancel`
+}
+
+// RunHandler handles the run.md of a workflow run with its jobs and
+//  artifacts along with actions to rerun or cancel it.
+type RunHandler struct {
+	Run       *workflowRun
+	Jobs      []*workflowJob
+	Artifacts []*artifact
+	Form      RunForm
+
+	id       int64
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+// runJobs lists the jobs of the latest attempt of a workflow run
+func runJobs(owner string, repo string, id int64) ([]*workflowJob, error) {
+	log.Printf("Listing the jobs of run %d of %s/%s\n", id, owner, repo)
+	jobs := struct {
+		Jobs []*workflowJob `json:"jobs"`
+	}{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs/%d/jobs?per_page=100", owner, repo, id), nil, &jobs)
+	return jobs.Jobs, err
+}
+
+// runArtifacts lists the artifacts of a workflow run
+func runArtifacts(owner string, repo string, id int64) ([]*artifact, error) {
+	log.Printf("Listing the artifacts of run %d of %s/%s\n", id, owner, repo)
+	artifacts := struct {
+		Artifacts []*artifact `json:"artifacts"`
+	}{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs/%d/artifacts?per_page=100", owner, repo, id), nil, &artifacts)
+	return artifacts.Artifacts, err
+}
+
+func (rh *RunHandler) load(owner string, repo string) error {
+	log.Printf("Reading run %d of %s/%s\n", rh.id, owner, repo)
+	run := &workflowRun{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs/%d", owner, repo, rh.id), nil, run)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := runJobs(owner, repo, rh.id)
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := runArtifacts(owner, repo, rh.id)
+	if err != nil {
+		return err
+	}
+
+	rh.Run = run
+	rh.Jobs = jobs
+	rh.Artifacts = artifacts
+	rh.Form = RunForm{Action: "none"}
+
+	return nil
+}
+
+func (rh *RunHandler) loadForm(name string) (interface{}, error) {
+	owner, repo := splitActionsPath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	err := rh.load(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	form := rh.Form
+	return &form, nil
+}
+
+func (rh *RunHandler) saveForm(name string, edited interface{}) error {
+	owner, repo := splitActionsPath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	return rh.save(owner, repo, edited.(*RunForm))
+}
+
+// save reruns or cancels the run depending on the chosen action
+func (rh *RunHandler) save(owner string, repo string, form *RunForm) error {
+	endpoints := map[string]string{"rerun": "rerun", "rerun-failed": "rerun-failed-jobs", "cancel": "cancel"}
+	endpoint, ok := endpoints[form.Action]
+	if !ok {
+		return nil
+	}
+
+	log.Printf("Taking action %s on run %d of %s/%s\n", form.Action, rh.id, owner, repo)
+	err := apiRequest("POST", fmt.Sprintf("repos/%s/%s/actions/runs/%d/%s", owner, repo, rh.id, endpoint), nil, nil)
+	if _, ok := err.(*github.AcceptedError); err != nil && !ok {
+		return err
+	}
+
+	rh.Form = RunForm{Action: "none"}
+
+	return nil
+}
+
+func (rh *RunHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the run.md file")
+}
+
+func (rh *RunHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo := splitActionsPath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	err := rh.load(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err = runMarkdown.Execute(&buf, rh)
+		if err != nil {
+			return err
+		}
+		rh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if rh.writefid != 0 {
+			return fmt.Errorf("Run doesn't support concurrent writes")
+		}
+
+		rh.writefid = fid
+		rh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (rh *RunHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if offset >= int64(rh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(rh.readbuf.Len()) {
+		return rh.readbuf.Bytes()[offset:], nil
+	}
+
+	return rh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (rh *RunHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if fid != rh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := rh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (rh *RunHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a run.md is not supported")
+}
+
+func (rh *RunHandler) Stat(name string) (protocol.Dir, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(rh.readbuf.Len())}, nil
+}
+
+func (rh *RunHandler) Wstat(name string, dir protocol.Dir) error {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if rh.writebuf != nil {
+		rh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (rh *RunHandler) Remove(name string) error {
+	return fmt.Errorf("Removing run.md isn't supported.")
+}
+
+func (rh *RunHandler) Clunk(name string, fid protocol.FID) error {
+	owner, repo := splitActionsPath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if fid != rh.writefid {
+		return nil
+	}
+	rh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(rh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &RunForm{}
+	_, err := markform.Diff(&rh.Form, markform.Parse(rh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return rh.save(owner, repo, form)
+}
+
+// JobsHandler handles the jobs directory of a workflow run with the
+//  log of each job, which are taken from the logs archive of the run.
+//  The archive is downloaded again until the run is completed.
+type JobsHandler struct {
+	dynamic.BasicDirHandler
+	id        int64
+	logs      map[string][]byte
+	completed bool
+	mu        sync.Mutex
+}
+
+func NewJobsHandler(jobsPath string, id int64) {
+	handler := &JobsHandler{id: id}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.logs == nil {
+			return true
+		}
+		_, ok := handler.logs[path.Base(name)]
+		return ok
+	}}
+
+	server.AddFileEntry(jobsPath, handler)
+}
+
+func (jh *JobsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := jh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && path.Ext(child) == ".log" {
+		err = jh.refresh(name)
+		if err != nil {
+			return -1, err
+		}
+		return jh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+// refresh downloads the logs archive of the run unless the run was
+//  already completed the last time.
+func (jh *JobsHandler) refresh(name string) error {
+	owner, repo := splitActionsPath(name)
+
+	jh.mu.Lock()
+	done := jh.completed
+	jh.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	log.Printf("Reading run %d of %s/%s\n", jh.id, owner, repo)
+	run := &workflowRun{}
+	err := apiRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs/%d", owner, repo, jh.id), nil, run)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Finding the logs of run %d of %s/%s\n", jh.id, owner, repo)
+	u, err := actionsLink(fmt.Sprintf("repos/%s/%s/actions/runs/%d/logs", owner, repo, jh.id))
+	if err != nil {
+		return err
+	}
+
+	logs := make(map[string][]byte)
+	if u != nil {
+		log.Printf("Downloading the logs of run %d of %s/%s\n", jh.id, owner, repo)
+		resp, err := http.Get(u.String())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Downloading the logs of run %d failed: %s", jh.id, resp.Status)
+		}
+
+		archive, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return err
+		}
+
+		for _, f := range r.File {
+			groups := jobLogPattern.FindStringSubmatch(f.Name)
+			if groups == nil {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+
+			logs[refFileName(groups[1])+".log"] = content
+		}
+	}
+
+	for fn := range logs {
+		server.AddFileEntry(path.Join(name, fn), &JobLogHandler{jh: jh})
+	}
+
+	jh.mu.Lock()
+	jh.logs = logs
+	jh.completed = run.Status == "completed" && u != nil
+	jh.mu.Unlock()
+
+	return nil
+}
+
+func (jh *JobsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := jh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return jh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// JobLogHandler handles the log of a job, which is kept by the jobs
+//  directory.
+type JobLogHandler struct {
+	dynamic.StaticFileHandler
+	jh *JobsHandler
+}
+
+func (jlh *JobLogHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		return fmt.Errorf("Logs are read-only")
+	}
+
+	jlh.jh.mu.Lock()
+	jlh.StaticFileHandler.Content = jlh.jh.logs[path.Base(name)]
+	jlh.jh.mu.Unlock()
+
+	return jlh.StaticFileHandler.Open(name, fid, mode)
+}
+
+func (jlh *JobLogHandler) Stat(name string) (protocol.Dir, error) {
+	jlh.jh.mu.Lock()
+	defer jlh.jh.mu.Unlock()
+
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(len(jlh.jh.logs[path.Base(name)]))}, nil
+}
+
+// ArtifactsHandler handles the artifacts directory of a workflow run
+//  with a zip file for each artifact.
+type ArtifactsHandler struct {
+	dynamic.BasicDirHandler
+	id     int64
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewArtifactsHandler(artifactsPath string, id int64) {
+	handler := &ArtifactsHandler{id: id}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(artifactsPath, handler)
+}
+
+func (ah *ArtifactsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := ah.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && path.Ext(child) == ".zip" {
+		err = ah.refresh(name)
+		if err != nil {
+			return -1, err
+		}
+		return ah.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (ah *ArtifactsHandler) refresh(name string) error {
+	owner, repo := splitActionsPath(name)
+	filter := make(map[string]bool)
+
+	artifacts, err := runArtifacts(owner, repo, ah.id)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range artifacts {
+		if a.Expired {
+			continue
+		}
+
+		artifactPath := path.Join(name, a.FileName())
+		server.AddFileEntry(artifactPath, &ArchiveHandler{link: artifactLink(a.ID), streams: make(map[protocol.FID]*archiveStream)})
+		filter[artifactPath] = true
+	}
+
+	ah.mu.Lock()
+	ah.filter = filter
+	ah.mu.Unlock()
+
+	return nil
+}
+
+func (ah *ArtifactsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := ah.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return ah.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// artifactLink finds where to download an artifact
+func artifactLink(id int64) func(name string) (*url.URL, error) {
+	return func(name string) (*url.URL, error) {
+		owner, repo := splitActionsPath(name)
+
+		log.Printf("Finding artifact %d of %s/%s\n", id, owner, repo)
+		u, err := actionsLink(fmt.Sprintf("repos/%s/%s/actions/artifacts/%d/zip", owner, repo, id))
+		if err == nil && u == nil {
+			return nil, fmt.Errorf("Artifact %s has expired", path.Base(name))
+		}
+		return u, err
+	}
+}
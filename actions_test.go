@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+func TestRunFormAction(t *testing.T) {
+	for _, action := range []string{"none", "rerun", "rerun-failed", "cancel"} {
+		orig := RunForm{Action: "none"}
+		doc := markform.Marshal(RunForm{Action: action}, "Action")
+
+		form := &RunForm{}
+		_, err := markform.Diff(&orig, markform.Parse([]byte("* "+doc+"\n")), form)
+		if err != nil {
+			t.Errorf("%s: %v", action, err)
+			continue
+		}
+
+		if form.Action != action {
+			t.Errorf("Expected action %s, got %s", action, form.Action)
+		}
+	}
+}
+
+func TestRunMarkdownAction(t *testing.T) {
+	rh := &RunHandler{Run: &workflowRun{}, Form: RunForm{Action: "none"}}
+	buf := &bytes.Buffer{}
+	err := runMarkdown.Execute(buf, rh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := strings.Replace(buf.String(), "(x) none () rerun () rerun-failed", "() none () rerun (x) rerun-failed", 1)
+	form := &RunForm{}
+	_, err = markform.Diff(&rh.Form, markform.Parse([]byte(doc)), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if form.Action != "rerun-failed" {
+		t.Errorf("Expected action rerun-failed, got %s", form.Action)
+	}
+}
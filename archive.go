@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+)
+
+var (
+	archiveFiles = []string{"archive.tar.gz", "archive.zip"}
+)
+
+// NewArchiveHandlers adds the source archives of a ref to the
+//  directory of the ref, such as a branch or a release.
+func NewArchiveHandlers(refPath string) {
+	for _, fn := range archiveFiles {
+		server.AddFileEntry(path.Join(refPath, fn), &ArchiveHandler{link: archiveLink, streams: make(map[protocol.FID]*archiveStream)})
+	}
+}
+
+// archiveLink finds where to download the source archive of a ref
+func archiveLink(name string) (*url.URL, error) {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(path.Dir(name)))))
+	repo := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	ref := refName(path.Base(path.Dir(name)))
+	format := github.Tarball
+	if path.Ext(name) == ".zip" {
+		format = github.Zipball
+	}
+
+	log.Printf("Finding the %s of %s in %s/%s\n", format, ref, owner, repo)
+	u, _, err := uncachedClient.Repositories.GetArchiveLink(context.Background(), owner, repo, format, &github.RepositoryContentGetOptions{Ref: ref})
+	return u, err
+}
+
+// archiveStream is an archive being downloaded for one fid. Only the
+//  part of the archive after the previous read is kept.
+type archiveStream struct {
+	body   io.ReadCloser
+	offset int64
+	buf    []byte
+	eof    bool
+	mu     sync.Mutex
+}
+
+// archiveChunkSize is the most that is read from an archive at once
+//  so that skipping far ahead doesn't hold it all in memory
+const archiveChunkSize = 64 * 1024
+
+// fill reads up to size more bytes of the archive, no more than a
+//  chunk at a time
+func (as *archiveStream) fill(size int64) error {
+	if size > archiveChunkSize {
+		size = archiveChunkSize
+	}
+	chunk := make([]byte, size)
+	n, err := as.body.Read(chunk)
+	as.buf = append(as.buf, chunk[:n]...)
+	if err == io.EOF {
+		as.eof = true
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ArchiveHandler handles an archive that is downloaded from a link,
+//  such as a tarball or zipball of a ref. The archive is streamed
+//  from GitHub as it's read so it must be read from the start to
+//  the end, like cp does. The length is only known once GitHub has
+//  reported it.
+type ArchiveHandler struct {
+	link    func(name string) (*url.URL, error)
+	length  int64
+	streams map[protocol.FID]*archiveStream
+	mu      sync.Mutex
+}
+
+func (ah *ArchiveHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of an archive")
+}
+
+func (ah *ArchiveHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		return fmt.Errorf("Archives are read-only")
+	}
+
+	u, err := ah.link(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Downloading %s\n", name)
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return fmt.Errorf("Downloading %s failed: %s", path.Base(name), resp.Status)
+	}
+
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	if resp.ContentLength >= 0 {
+		ah.length = resp.ContentLength
+	}
+	ah.streams[fid] = &archiveStream{body: resp.Body}
+
+	return nil
+}
+
+func (ah *ArchiveHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	ah.mu.Lock()
+	stream, ok := ah.streams[fid]
+	ah.mu.Unlock()
+
+	if !ok {
+		return []byte{}, fmt.Errorf("%s is not open for reading", path.Base(name))
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if offset < stream.offset {
+		return []byte{}, fmt.Errorf("%s can only be read from the start to the end", path.Base(name))
+	}
+
+	// Forget what was read before the offset
+	for offset > stream.offset && !(stream.eof && len(stream.buf) == 0) {
+		if len(stream.buf) == 0 {
+			err := stream.fill(offset - stream.offset)
+			if err != nil {
+				return []byte{}, err
+			}
+			continue
+		}
+
+		skip := offset - stream.offset
+		if skip > int64(len(stream.buf)) {
+			skip = int64(len(stream.buf))
+		}
+		stream.buf = stream.buf[skip:]
+		stream.offset += skip
+	}
+
+	for !stream.eof && int64(len(stream.buf)) < count {
+		err := stream.fill(count - int64(len(stream.buf)))
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	if stream.eof {
+		ah.mu.Lock()
+		ah.length = stream.offset + int64(len(stream.buf))
+		ah.mu.Unlock()
+	}
+
+	if count >= int64(len(stream.buf)) {
+		return stream.buf, nil
+	}
+
+	return stream.buf[:count], nil
+}
+
+func (ah *ArchiveHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	return 0, fmt.Errorf("Archives are read-only")
+}
+
+func (ah *ArchiveHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of an archive is not supported")
+}
+
+func (ah *ArchiveHandler) Stat(name string) (protocol.Dir, error) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(ah.length)}, nil
+}
+
+func (ah *ArchiveHandler) Wstat(name string, dir protocol.Dir) error {
+	return fmt.Errorf("Archives are read-only")
+}
+
+func (ah *ArchiveHandler) Remove(name string) error {
+	return fmt.Errorf("Archives can't be removed")
+}
+
+func (ah *ArchiveHandler) Clunk(name string, fid protocol.FID) error {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+
+	stream, ok := ah.streams[fid]
+	if !ok {
+		return nil
+	}
+	delete(ah.streams, fid)
+
+	return stream.body.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Harvey-OS/ninep/protocol"
+)
+
+// countingReader records the largest read of the archive
+type countingReader struct {
+	io.Reader
+	largest int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	if len(p) > cr.largest {
+		cr.largest = len(p)
+	}
+	return cr.Reader.Read(p)
+}
+
+func TestArchiveRead(t *testing.T) {
+	content := make([]byte, 10*archiveChunkSize+123)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	body := &countingReader{Reader: bytes.NewReader(content)}
+	ah := &ArchiveHandler{streams: map[protocol.FID]*archiveStream{1: {body: ioutil.NopCloser(body)}}}
+
+	buf, err := ah.Read("archive.zip", 1, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, content[:10]) {
+		t.Errorf("Unexpected start %v", buf)
+	}
+
+	// Skipping far ahead is done in chunks
+	offset := int64(9*archiveChunkSize + 7)
+	buf, err = ah.Read("archive.zip", 1, offset, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, content[offset:offset+100]) {
+		t.Errorf("Unexpected content at %d", offset)
+	}
+	if body.largest > archiveChunkSize {
+		t.Errorf("Expected reads of at most %d bytes, got %d", archiveChunkSize, body.largest)
+	}
+
+	_, err = ah.Read("archive.zip", 1, 0, 10)
+	if err == nil {
+		t.Errorf("Expected an error for reading backwards")
+	}
+
+	buf, err = ah.Read("archive.zip", 1, int64(len(content))-5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, content[len(content)-5:]) || ah.length != int64(len(content)) {
+		t.Errorf("Unexpected end %v with length %d", buf, ah.length)
+	}
+}
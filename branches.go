@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	branchMarkdown = template.Must(template.New("branch").Funcs(funcMap).Parse(
+		`# Branch {{ .Name }}
+{{ if .Branch }}
+* Commit: {{ .Branch.GetCommit.SHA }} {{ .Branch.GetCommit.Commit.Author.Date.Format "2006-01-02T15:04:05Z07:00" }} {{ .Branch.GetCommit.Commit.Author.GetName }}
+* Protected: {{ if .Branch.GetProtected }}yes{{ else }}no{{ end }}
+{{- with .Protection }}{{ with .RequiredStatusChecks }}
+* Required status checks: {{ range .Contexts }}{{ . }} {{ end }}{{ if .Strict }}(up to date){{ end }}{{ end }}{{ with .RequiredPullRequestReviews }}
+* Required approving reviews: {{ .RequiredApprovingReviewCount }}{{ if .RequireCodeOwnerReviews }} (code owners){{ end }}{{ end }}{{ with .EnforceAdmins }}
+* Enforced for admins: {{ if .Enabled }}yes{{ else }}no{{ end }}{{ end }}{{ end }}
+{{- if .Comparison }}
+* Compared to {{ .DefaultBranch }}: {{ .Comparison.GetAheadBy }} ahead, {{ .Comparison.GetBehindBy }} behind{{ end }}
+
+{{ markdown .Branch.GetCommit.Commit.GetMessage }}
+
+To delete the branch check the box, save this file and then remove it.
+
+* {{ markform .Form "Delete" }}
+{{ else }}
+This branch doesn't exist yet. Fill in the branch, tag or commit that it starts from and save
+this file to create it.
+
+* {{ markform .Form "From" }}
+{{ end }}
+`))
+)
+
+// branchName is the name of the branch of a file in the branches directory
+func branchName(name string) string {
+	fn := path.Base(name)
+	return refName(strings.TrimSuffix(fn, path.Ext(fn)))
+}
+
+// BranchesHandler handles the branches directory of a repository,
+//  which has a markform file for each branch. New branches are
+//  created by creating new files in the directory.
+type BranchesHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewBranchesHandler(repoPath string) {
+	handler := &BranchesHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(path.Join(repoPath, "branches"), handler)
+}
+
+func (bh *BranchesHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := bh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		owner := path.Base(path.Dir(path.Dir(name)))
+		repo := path.Base(path.Dir(name))
+
+		// The directory of a branch is named after the branch
+		branch := refName(child)
+		if path.Ext(child) == ".md" || path.Ext(child) == ".json" {
+			branch = branchName(child)
+		}
+
+		log.Printf("Checking if branch %s exists\n", branch)
+		_, _, err = client.Repositories.GetBranch(context.Background(), owner, repo, branch)
+		if err != nil {
+			return -1, err
+		}
+
+		bh.add(name, branch)
+		return bh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+// add adds the files of an existing branch to the directory
+func (bh *BranchesHandler) add(name string, branch string) {
+	branchPath := path.Join(name, refFileName(branch))
+	NewBranchHandler(branchPath)
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if bh.filter != nil {
+		bh.filter[branchPath] = true
+		bh.filter[branchPath+".md"] = true
+		bh.filter[branchPath+".json"] = true
+	}
+}
+
+func (bh *BranchesHandler) refresh(name string) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	filter := make(map[string]bool)
+	options := &github.ListOptions{PerPage: 100}
+
+	for {
+		log.Printf("Listing branches for repo %s/%s\n", owner, repo)
+		branches, resp, err := client.Repositories.ListBranches(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+
+		for _, branch := range branches {
+			branchPath := path.Join(name, refFileName(branch.GetName()))
+			NewBranchHandler(branchPath)
+			filter[branchPath] = true
+			filter[branchPath+".md"] = true
+			filter[branchPath+".json"] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	bh.mu.Lock()
+	previous := bh.filter
+	bh.mu.Unlock()
+
+	// Keep the new branches that haven't been saved yet
+	for fn := range previous {
+		if filter[fn] {
+			continue
+		}
+
+		var branch *BranchHandler
+		server.MatchFile(func(f *dynamic.FileEntry) bool {
+			if f.Name != fn {
+				return false
+			}
+			branch, _ = f.Handler.(*BranchHandler)
+			return true
+		})
+		if branch != nil && branch.isNew() {
+			filter[fn] = true
+		}
+	}
+
+	bh.mu.Lock()
+	bh.filter = filter
+	bh.mu.Unlock()
+
+	return nil
+}
+
+func (bh *BranchesHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := bh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return bh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (bh *BranchesHandler) CreateChild(name string, child string) (int, error) {
+	if path.Ext(child) != ".md" {
+		return -1, fmt.Errorf("New branches are created with a file named after the branch ending in .md")
+	}
+
+	childPath := path.Join(name, child)
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return -1, fmt.Errorf("Branch %s already exists", branchName(child))
+	}
+
+	handler := &BranchHandler{Name: branchName(child), created: true, readbuf: &bytes.Buffer{}}
+	err := branchMarkdown.Execute(handler.readbuf, handler)
+	if err != nil {
+		return -1, err
+	}
+	idx = server.AddFileEntry(childPath, handler)
+
+	bh.mu.Lock()
+	if bh.filter != nil {
+		bh.filter[childPath] = true
+	}
+	bh.mu.Unlock()
+
+	return idx, nil
+}
+
+// BranchForm holds the editable fields of a branch. The branch
+//  that a new branch starts from is only used when it's created.
+type BranchForm struct {
+	From   string ` = ___`
+	Delete bool   ` = []`
+}
+
+// BranchHandler handles the markform file of a branch showing its
+//  head commit, protection and how far it is from the default branch.
+type BranchHandler struct {
+	Name          string
+	Branch        *github.Branch
+	Protection    *github.Protection
+	Comparison    *github.CommitsComparison
+	DefaultBranch string
+	Form          BranchForm
+
+	created  bool
+	mtime    time.Time
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewBranchHandler(branchPath string) {
+	handler := &BranchHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(branchPath+".md", handler)
+	NewFormJSONHandler(branchPath+".json", handler)
+	NewBranchDirHandler(branchPath)
+}
+
+// NewBranchDirHandler adds the directory of a branch, which has the
+//  source archives of the branch.
+func NewBranchDirHandler(branchPath string) {
+	server.AddFileEntry(branchPath, &dynamic.BasicDirHandler{server, nil})
+	NewArchiveHandlers(branchPath)
+}
+
+// isNew reports whether the branch still needs to be created
+func (bh *BranchHandler) isNew() bool {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	return bh.created
+}
+
+func (bh *BranchHandler) load(owner string, repo string, branch string) error {
+	log.Printf("Reading branch %s of %s/%s\n", branch, owner, repo)
+	b, _, err := client.Repositories.GetBranch(context.Background(), owner, repo, branch)
+	if err != nil {
+		return err
+	}
+
+	bh.Name = branch
+	bh.Branch = b
+	bh.mtime = b.GetCommit().GetCommit().GetAuthor().GetDate()
+
+	// Only admins can see the details of the protection
+	bh.Protection = nil
+	if b.GetProtected() {
+		log.Printf("Reading protection of branch %s of %s/%s\n", branch, owner, repo)
+		protection, _, err := client.Repositories.GetBranchProtection(context.Background(), owner, repo, branch)
+		if err == nil {
+			bh.Protection = protection
+		}
+	}
+
+	log.Printf("Reading repo %s/%s\n", owner, repo)
+	r, _, err := client.Repositories.Get(context.Background(), owner, repo)
+	if err != nil {
+		return err
+	}
+	bh.DefaultBranch = r.GetDefaultBranch()
+
+	bh.Comparison = nil
+	if bh.DefaultBranch != branch {
+		log.Printf("Comparing branch %s to %s in %s/%s\n", branch, bh.DefaultBranch, owner, repo)
+		comparison, _, err := client.Repositories.CompareCommits(context.Background(), owner, repo, bh.DefaultBranch, branch)
+		if err != nil {
+			return err
+		}
+		bh.Comparison = comparison
+	}
+
+	return nil
+}
+
+func (bh *BranchHandler) loadForm(name string) (interface{}, error) {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if !bh.created {
+		err := bh.load(owner, repo, branchName(name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	form := bh.Form
+	return &form, nil
+}
+
+func (bh *BranchHandler) saveForm(name string, edited interface{}) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	return bh.save(owner, repo, name, edited.(*BranchForm))
+}
+
+// save creates the branch if it is new, otherwise the form is kept
+//  so that the branch can be deleted once it is confirmed.
+func (bh *BranchHandler) save(owner string, repo string, name string, form *BranchForm) error {
+	if !bh.created {
+		bh.Form = *form
+		return nil
+	}
+
+	branch := branchName(name)
+	if strings.TrimSpace(form.From) == "" {
+		return fmt.Errorf("Fill in the branch, tag or commit to create branch %s from", branch)
+	}
+
+	log.Printf("Finding commit %s in %s/%s\n", form.From, owner, repo)
+	sha, _, err := client.Repositories.GetCommitSHA1(context.Background(), owner, repo, strings.TrimSpace(form.From), "")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Creating branch %s at %s in %s/%s\n", branch, sha, owner, repo)
+	ref := "refs/heads/" + branch
+	_, _, err = client.Git.CreateRef(context.Background(), owner, repo, &github.Reference{Ref: &ref, Object: &github.GitObject{SHA: &sha}})
+	if err != nil {
+		return err
+	}
+
+	bh.created = false
+	bh.Form = BranchForm{}
+	NewFormJSONHandler(strings.TrimSuffix(name, path.Ext(name))+".json", bh)
+	NewBranchDirHandler(strings.TrimSuffix(name, path.Ext(name)))
+
+	return nil
+}
+
+func (bh *BranchHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the %s file", path.Base(name))
+}
+
+func (bh *BranchHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if mode == protocol.OREAD && !bh.created {
+		err := bh.load(owner, repo, branchName(name))
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.Buffer{}
+		err = branchMarkdown.Execute(&buf, bh)
+		if err != nil {
+			return err
+		}
+		bh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if bh.writefid != 0 {
+			return fmt.Errorf("Branch doesn't support concurrent writes")
+		}
+
+		bh.writefid = fid
+		bh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (bh *BranchHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if offset >= int64(bh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(bh.readbuf.Len()) {
+		return bh.readbuf.Bytes()[offset:], nil
+	}
+
+	return bh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (bh *BranchHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if fid != bh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := bh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (bh *BranchHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a branch is not supported")
+}
+
+func (bh *BranchHandler) Stat(name string) (protocol.Dir, error) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(bh.readbuf.Len()), Mtime: unixTime(bh.mtime)}, nil
+}
+
+func (bh *BranchHandler) Wstat(name string, dir protocol.Dir) error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if bh.writebuf != nil {
+		bh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (bh *BranchHandler) Remove(name string) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	branch := branchName(name)
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	// A branch that was never created only needs to be forgotten
+	if bh.created {
+		return nil
+	}
+
+	if !bh.Form.Delete {
+		return fmt.Errorf("Check Delete in %s and save it before removing it to delete branch %s", path.Base(name), branch)
+	}
+
+	log.Printf("Deleting branch %s in %s/%s\n", branch, owner, repo)
+	_, err := client.Git.DeleteRef(context.Background(), owner, repo, "heads/"+branch)
+	if err != nil {
+		return err
+	}
+
+	bh.Form = BranchForm{}
+	server.RemoveFileEntry(strings.TrimSuffix(name, path.Ext(name)) + ".json")
+	server.RemoveFileEntry(strings.TrimSuffix(name, path.Ext(name)))
+	return nil
+}
+
+func (bh *BranchHandler) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	if fid != bh.writefid {
+		return nil
+	}
+	bh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(bh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &BranchForm{}
+	_, err := markform.Diff(&bh.Form, markform.Parse(bh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return bh.save(owner, repo, name, form)
+}
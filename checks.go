@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	checkRunMarkdown = template.Must(template.New("checkRun").Funcs(funcMap).Parse(
+		`# {{ .CheckRun.GetName }}
+
+* App: {{ .CheckRun.App.GetName }}
+* Status: {{ .CheckRun.GetStatus }}
+* Conclusion: {{ .CheckRun.GetConclusion }}
+* Started: {{ with .CheckRun.StartedAt }}{{ .Format "2006-01-02T15:04:05Z07:00" }}{{ end }}
+* Completed: {{ with .CheckRun.CompletedAt }}{{ .Format "2006-01-02T15:04:05Z07:00" }}{{ end }}
+* Details: {{ .CheckRun.GetHTMLURL }}
+{{ with .CheckRun.Output }}
+## {{ .GetTitle }}
+
+{{ .GetSummary }}
+
+{{ .GetText }}
+{{ end }}`))
+
+	commitStatusMarkdown = template.Must(template.New("commitStatus").Funcs(funcMap).Parse(
+		`# Status of {{ .SHA }}
+
+Fill in a status and save this file to post it on the commit. A status with the same context
+replaces the one that was posted before.
+
+* {{ markform .Form "Context" }}
+* {{ markform .Form "State" }}
+* {{ markform .Form "Description" }}
+* {{ markform .Form "TargetURL" }}
+
+## Checks
+
+* Overall: {{ .Checks.State }}{{ checks .Checks }}
+`))
+)
+
+// commitChecks are the statuses and check runs of a commit, which
+//  GitHub shows together as the checks of the commit.
+type commitChecks struct {
+	Status    *github.CombinedStatus
+	CheckRuns []*github.CheckRun
+	Err       error
+}
+
+// loadChecks reads the combined status and the latest check runs of
+//  a commit
+func loadChecks(owner string, repo string, ref string) (*commitChecks, error) {
+	log.Printf("Reading status of commit %s of %s/%s\n", ref, owner, repo)
+	status, _, err := client.Repositories.GetCombinedStatus(context.Background(), owner, repo, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := &commitChecks{Status: status, CheckRuns: []*github.CheckRun{}}
+	options := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		log.Printf("Listing check runs of commit %s of %s/%s\n", ref, owner, repo)
+		runs, resp, err := client.Checks.ListCheckRunsForRef(context.Background(), owner, repo, ref, options)
+		if err != nil {
+			return nil, err
+		}
+		checks.CheckRuns = append(checks.CheckRuns, runs.CheckRuns...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	return checks, nil
+}
+
+// loadChecksForDisplay reads the checks of a commit for a file that
+//  shows them among other things. The file is still shown when the
+//  checks can't be read, with the checks shown as unavailable.
+func loadChecksForDisplay(owner string, repo string, ref string) *commitChecks {
+	checks, err := loadChecks(owner, repo, ref)
+	if err != nil {
+		log.Printf("Unable to read the checks of commit %s of %s/%s: %v\n", ref, owner, repo, err)
+		return &commitChecks{Err: err}
+	}
+	return checks
+}
+
+// State is the overall state of the statuses and check runs, which
+//  is failure if any of them failed, pending if any of them haven't
+//  finished and otherwise success.
+func (cc *commitChecks) State() string {
+	if cc != nil && cc.Err != nil {
+		return "unavailable"
+	}
+	if cc == nil || (cc.Status.GetTotalCount() == 0 && len(cc.CheckRuns) == 0) {
+		return "none"
+	}
+
+	state := "success"
+	if cc.Status.GetTotalCount() != 0 {
+		state = cc.Status.GetState()
+	}
+
+	for _, run := range cc.CheckRuns {
+		switch {
+		case run.GetStatus() != "completed":
+			if state == "success" {
+				state = "pending"
+			}
+		case run.GetConclusion() == "failure" || run.GetConclusion() == "timed_out" || run.GetConclusion() == "cancelled" || run.GetConclusion() == "action_required":
+			state = "failure"
+		}
+	}
+
+	return state
+}
+
+// checkList lists each status and check run of a commit with its
+//  state, summary and details link as a nested list.
+func checkList(cc *commitChecks) string {
+	if cc == nil {
+		return ""
+	}
+	if cc.Err != nil {
+		return fmt.Sprintf(" (%v)", cc.Err)
+	}
+
+	buf := bytes.Buffer{}
+	for _, status := range cc.Status.Statuses {
+		fmt.Fprintf(&buf, "\n  * %s: %s - %s", status.GetContext(), status.GetState(), status.GetDescription())
+		if status.GetTargetURL() != "" {
+			fmt.Fprintf(&buf, " (%s)", status.GetTargetURL())
+		}
+	}
+
+	for _, run := range cc.CheckRuns {
+		state := run.GetStatus()
+		if state == "completed" {
+			state = run.GetConclusion()
+		}
+
+		output := run.GetOutput()
+		summary := output.GetTitle()
+		if summary == "" {
+			summary = strings.TrimSpace(strings.SplitN(output.GetSummary(), "\n", 2)[0])
+		}
+
+		fmt.Fprintf(&buf, "\n  * %s: %s - %s", run.GetName(), state, summary)
+		if run.GetHTMLURL() != "" {
+			fmt.Fprintf(&buf, " (%s)", run.GetHTMLURL())
+		}
+	}
+
+	return buf.String()
+}
+
+// checkRunFileName is the name of the file of a check run in the
+//  checks directory of a commit
+func checkRunFileName(run *github.CheckRun) string {
+	return refFileName(run.GetName()) + ".md"
+}
+
+// splitChecksPath splits the name of a file in the directory of a
+//  commit into the owner, repo and SHA of the commit.
+func splitChecksPath(name string) (string, string, string) {
+	parts := strings.SplitN(name, "/", 7)
+	return parts[2], parts[3], parts[5]
+}
+
+// NewCommitDirHandler adds the directory of a commit with the output
+//  of its check runs and the status.md to post a status.
+func NewCommitDirHandler(commitPath string) {
+	server.AddFileEntry(commitPath, &dynamic.BasicDirHandler{server, nil})
+	NewChecksHandler(path.Join(commitPath, "checks"))
+	NewCommitStatusHandler(path.Join(commitPath, "status"))
+}
+
+// ChecksHandler handles the checks directory of a commit with the
+//  output of each of the check runs.
+type ChecksHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewChecksHandler(checksPath string) {
+	handler := &ChecksHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(checksPath, handler)
+}
+
+func (ch *ChecksHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := ch.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && path.Ext(child) == ".md" {
+		err = ch.refresh(name)
+		if err != nil {
+			return -1, err
+		}
+		return ch.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (ch *ChecksHandler) refresh(name string) error {
+	owner, repo, sha := splitChecksPath(name)
+	filter := make(map[string]bool)
+
+	checks, err := loadChecks(owner, repo, sha)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range checks.CheckRuns {
+		runPath := path.Join(name, checkRunFileName(run))
+		server.AddFileEntry(runPath, &CheckRunHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}})
+
+		var handler *CheckRunHandler
+		server.MatchFile(func(f *dynamic.FileEntry) bool {
+			if f.Name != runPath {
+				return false
+			}
+			handler, _ = f.Handler.(*CheckRunHandler)
+			return true
+		})
+		if handler != nil {
+			handler.setID(run.GetID())
+		}
+		filter[runPath] = true
+	}
+
+	ch.mu.Lock()
+	ch.filter = filter
+	ch.mu.Unlock()
+
+	return nil
+}
+
+func (ch *ChecksHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := ch.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return ch.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// CheckRunHandler handles the output of a check run. The check run
+//  is the latest one with its name so the ID changes when it's
+//  run again.
+type CheckRunHandler struct {
+	dynamic.StaticFileHandler
+	CheckRun *github.CheckRun
+
+	id int64
+	mu sync.Mutex
+}
+
+func (crh *CheckRunHandler) setID(id int64) {
+	crh.mu.Lock()
+	defer crh.mu.Unlock()
+
+	crh.id = id
+}
+
+func (crh *CheckRunHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, _ := splitChecksPath(name)
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		return fmt.Errorf("Check runs are read-only")
+	}
+
+	crh.mu.Lock()
+	defer crh.mu.Unlock()
+
+	log.Printf("Reading check run %d of %s/%s\n", crh.id, owner, repo)
+	run, _, err := client.Checks.GetCheckRun(context.Background(), owner, repo, crh.id)
+	if err != nil {
+		return err
+	}
+	crh.CheckRun = run
+
+	buf := bytes.Buffer{}
+	err = checkRunMarkdown.Execute(&buf, crh)
+	if err != nil {
+		return err
+	}
+
+	crh.StaticFileHandler.Content = buf.Bytes()
+
+	return crh.StaticFileHandler.Open(name, fid, mode)
+}
+
+// CommitStatusForm holds a status to post on a commit
+type CommitStatusForm struct {
+	Context     string ` = ___`
+	State       string ` = () pending () success () error () failure`
+	Description string ` = ___`
+	TargetURL   string ` = ___`
+}
+
+// CommitStatusHandler handles the status.md of a commit that posts
+//  a status when it's saved, which is how bots report on commits.
+type CommitStatusHandler struct {
+	SHA    string
+	Checks *commitChecks
+	Form   CommitStatusForm
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewCommitStatusHandler(statusPath string) {
+	handler := &CommitStatusHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(statusPath+".md", handler)
+	NewFormJSONHandler(statusPath+".json", handler)
+}
+
+func (csh *CommitStatusHandler) loadForm(name string) (interface{}, error) {
+	return &CommitStatusForm{State: "pending"}, nil
+}
+
+func (csh *CommitStatusHandler) saveForm(name string, edited interface{}) error {
+	owner, repo, sha := splitChecksPath(name)
+
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	return csh.save(owner, repo, sha, edited.(*CommitStatusForm))
+}
+
+// save posts the status on the commit
+func (csh *CommitStatusHandler) save(owner string, repo string, sha string, form *CommitStatusForm) error {
+	if form.State == "" {
+		return fmt.Errorf("The State of the status is required")
+	}
+
+	status := &github.RepoStatus{State: &form.State}
+	if form.Context != "" {
+		status.Context = &form.Context
+	}
+	if form.Description != "" {
+		status.Description = &form.Description
+	}
+	if form.TargetURL != "" {
+		status.TargetURL = &form.TargetURL
+	}
+
+	log.Printf("Posting status %s of commit %s of %s/%s\n", form.State, sha, owner, repo)
+	_, _, err := client.Repositories.CreateStatus(context.Background(), owner, repo, sha, status)
+	return err
+}
+
+func (csh *CommitStatusHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the status.md file")
+}
+
+func (csh *CommitStatusHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, sha := splitChecksPath(name)
+
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	if mode == protocol.OREAD {
+		checks, err := loadChecks(owner, repo, sha)
+		if err != nil {
+			return err
+		}
+		csh.SHA = sha
+		csh.Checks = checks
+		csh.Form = CommitStatusForm{State: "pending"}
+
+		buf := bytes.Buffer{}
+		err = commitStatusMarkdown.Execute(&buf, csh)
+		if err != nil {
+			return err
+		}
+		csh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if csh.writefid != 0 {
+			return fmt.Errorf("Status doesn't support concurrent writes")
+		}
+
+		csh.writefid = fid
+		csh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (csh *CommitStatusHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	if offset >= int64(csh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(csh.readbuf.Len()) {
+		return csh.readbuf.Bytes()[offset:], nil
+	}
+
+	return csh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (csh *CommitStatusHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	if fid != csh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := csh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (csh *CommitStatusHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a status.md is not supported")
+}
+
+func (csh *CommitStatusHandler) Stat(name string) (protocol.Dir, error) {
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(csh.readbuf.Len())}, nil
+}
+
+func (csh *CommitStatusHandler) Wstat(name string, dir protocol.Dir) error {
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	if csh.writebuf != nil {
+		csh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (csh *CommitStatusHandler) Remove(name string) error {
+	return fmt.Errorf("Removing status.md isn't supported.")
+}
+
+func (csh *CommitStatusHandler) Clunk(name string, fid protocol.FID) error {
+	owner, repo, sha := splitChecksPath(name)
+
+	csh.mu.Lock()
+	defer csh.mu.Unlock()
+
+	if fid != csh.writefid {
+		return nil
+	}
+	csh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(csh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &CommitStatusForm{}
+	err := markform.Unmarshal(markform.Parse(csh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return csh.save(owner, repo, sha, form)
+}
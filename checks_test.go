@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestChecksState(t *testing.T) {
+	completed := "completed"
+	success := "success"
+	failure := "failure"
+	queued := "queued"
+
+	tests := []struct {
+		name    string
+		checks  *commitChecks
+		state   string
+		listing string
+	}{
+		{"not loaded", nil, "none", ""},
+		{"no checks", &commitChecks{Status: &github.CombinedStatus{}}, "none", ""},
+		{"unavailable", &commitChecks{Err: errors.New("403 Forbidden")}, "unavailable", " (403 Forbidden)"},
+		{"passed", &commitChecks{Status: &github.CombinedStatus{}, CheckRuns: []*github.CheckRun{{Name: github.String("build"), Status: &completed, Conclusion: &success}}}, "success", "\n  * build: success - "},
+		{"running", &commitChecks{Status: &github.CombinedStatus{}, CheckRuns: []*github.CheckRun{{Name: github.String("build"), Status: &queued}}}, "pending", "\n  * build: queued - "},
+		{"failed", &commitChecks{Status: &github.CombinedStatus{}, CheckRuns: []*github.CheckRun{{Name: github.String("build"), Status: &queued}, {Name: github.String("test"), Status: &completed, Conclusion: &failure}}}, "failure", "\n  * build: queued - \n  * test: failure - "},
+	}
+
+	for _, test := range tests {
+		if state := test.checks.State(); state != test.state {
+			t.Errorf("%s: expected state %s, got %s", test.name, test.state, state)
+		}
+		if listing := checkList(test.checks); listing != test.listing {
+			t.Errorf("%s: expected listing %q, got %q", test.name, test.listing, listing)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+
+Markform is a command for working with markform documents outside of ghfs. The fields of the form
+are described by a schema, which is a JSON object that maps each field name to its markform struct
+tag in the order that the fields should appear.
+
+        {"Name": "* = ___[50]", "Gender": "* = () male () female", "Biography": " = <<<"}
+
+Validate checks that a document has all of the fields in the schema, that the values are allowed and
+that the required fields are filled in. Extract writes the values of the fields in a document as a JSON
+object. Fill executes a text/template with the values from a JSON object, where {{ markform . "Name" }}
+renders the Name field.
+
+        markform validate -schema person.json < person.md
+        markform extract -schema person.json < person.md > person.json
+        markform fill -schema person.json -template person.tmpl < person.json > person.md
+
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: markform validate|extract|fill -schema schema.json [-template template.md]\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	mode := os.Args[1]
+	flags := flag.NewFlagSet(mode, flag.ExitOnError)
+	schemaFile := flags.String("schema", "", "JSON schema of the form fields")
+	templateFile := flags.String("template", "", "Document template for the fill mode")
+	flags.Parse(os.Args[2:])
+
+	if *schemaFile == "" {
+		usage()
+	}
+
+	schema, err := ioutil.ReadFile(*schemaFile)
+	if err != nil {
+		fail(err)
+	}
+
+	t, err := structOf(schema)
+	if err != nil {
+		fail(err)
+	}
+
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fail(err)
+	}
+
+	switch mode {
+	case "validate":
+		errs := validate(t, input)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		if len(errs) != 0 {
+			os.Exit(1)
+		}
+	case "extract":
+		out, err := extract(t, input)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("%s\n", out)
+	case "fill":
+		if *templateFile == "" {
+			usage()
+		}
+
+		text, err := ioutil.ReadFile(*templateFile)
+		if err != nil {
+			fail(err)
+		}
+
+		out, err := fill(t, string(text), input)
+		if err != nil {
+			fail(err)
+		}
+		os.Stdout.Write(out)
+	default:
+		usage()
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "markform: %v\n", err)
+	os.Exit(1)
+}
+
+// structOf builds a struct type from the schema with a field
+//  for each entry that is tagged with its markform tag.
+func structOf(schema []byte) (reflect.Type, error) {
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("Schema must be a JSON object")
+	}
+
+	fields := []reflect.StructField{}
+	seen := map[string]bool{}
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name := tok.(string)
+		if seen[name] {
+			return nil, fmt.Errorf("Field %s is in the schema more than once", name)
+		}
+		seen[name] = true
+
+		var tag string
+		err = dec.Decode(&tag)
+		if err != nil {
+			return nil, fmt.Errorf("Tag of field %s must be a string: %v", name, err)
+		}
+
+		if !token.IsIdentifier(name) || !token.IsExported(name) {
+			return nil, fmt.Errorf("Field name %q must be a Go identifier that starts with an upper case letter", name)
+		}
+
+		ft, ok := markform.TypeOf(tag)
+		if !ok {
+			return nil, fmt.Errorf("Field %s has an unknown markform tag: %q", name, tag)
+		}
+
+		fields = append(fields, reflect.StructField{Name: name, Type: ft, Tag: reflect.StructTag(tag)})
+	}
+
+	return reflect.StructOf(fields), nil
+}
+
+// validate checks the document against the struct type returning
+//  all of the problems that were found.
+func validate(t reflect.Type, doc []byte) []error {
+	errs := []error{}
+	tree := markform.Parse(doc)
+
+	v := reflect.New(t)
+	err := markform.Unmarshal(tree, v.Interface())
+	if err != nil {
+		errs = append(errs, err)
+	} else if err = markform.Validate(v.Interface()); err != nil {
+		errs = append(errs, err)
+	}
+
+	found := map[string]bool{}
+	for _, name := range markform.Fields(tree) {
+		if _, ok := t.FieldByName(name); !ok {
+			errs = append(errs, fmt.Errorf("Unknown field %s", name))
+		}
+		found[name] = true
+	}
+
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if !found[f.Name] {
+			errs = append(errs, fmt.Errorf("Missing field %s", f.Name))
+			continue
+		}
+
+		if strings.HasPrefix(string(f.Tag), "*") && isEmpty(v.Elem().Field(idx)) {
+			errs = append(errs, fmt.Errorf("Required field %s is empty", f.Name))
+		}
+	}
+
+	return errs
+}
+
+// extract reads the values of the fields in the document as JSON
+func extract(t reflect.Type, doc []byte) ([]byte, error) {
+	v := reflect.New(t)
+	err := markform.Unmarshal(markform.Parse(doc), v.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(v.Interface(), "", "  ")
+}
+
+// fill executes the template with the values from the JSON object
+//  after checking that they are allowed.
+func fill(t reflect.Type, text string, input []byte) ([]byte, error) {
+	tmpl, err := template.New("fill").Funcs(map[string]interface{}{"markform": markform.Marshal}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.New(t)
+	err = json.Unmarshal(input, v.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	err = markform.Validate(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	err = tmpl.Execute(&buf, v.Elem().Interface())
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice:
+		return v.Len() == 0
+	case reflect.Struct:
+		return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+	}
+	return false
+}
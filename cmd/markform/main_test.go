@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const personSchema = `{"Name": "* = ___[50]", "Gender": " = () male () female", "Clubs": " = [] chess [] band", "Biography": " = <<<"}`
+
+func TestStructOf(t *testing.T) {
+	typ, err := structOf([]byte(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for idx := 0; idx < typ.NumField(); idx++ {
+		names = append(names, typ.Field(idx).Name)
+	}
+	if strings.Join(names, " ") != "Name Gender Clubs Biography" {
+		t.Errorf("Unexpected fields %v", names)
+	}
+
+	bad := []string{
+		`["Name"]`,
+		`{"Foo Bar": " = ___"}`,
+		`{"1x": " = ___"}`,
+		`{"name": " = ___"}`,
+		`{"": " = ___"}`,
+		`{"Name": " = ___", "Name": " = ___"}`,
+		`{"Name": 1}`,
+		`{"Name": " = ???"}`,
+	}
+	for _, schema := range bad {
+		_, err := structOf([]byte(schema))
+		if err == nil {
+			t.Errorf("Expected an error for schema %s", schema)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	typ, err := structOf([]byte(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		doc  string
+		errs int
+	}{
+		{"* Name* = John___[50]\n* Gender = (x) male () female\n* Clubs = [x] chess [] band\n\nBiography = <<<EOF\nHi\nEOF\n", 0},
+		{"* Name* = ___[50]\n* Gender = () male () female\n* Clubs = [] chess [] band\n\nBiography = <<<EOF\nEOF\n", 1},
+		{"* Name* = John___[50]\n* Gender = (x) robot\n* Clubs = [] chess [] band\n\nBiography = <<<EOF\nEOF\n", 1},
+		{"* Name* = John___[50]\n* Gender = () male () female\n* Clubs = [x] chess [x] golf\n\nBiography = <<<EOF\nEOF\n", 1},
+		{"* Name* = John___[50]\n* Age = ___\n", 4},
+	}
+
+	for _, test := range tests {
+		errs := validate(typ, []byte(test.doc))
+		if len(errs) != test.errs {
+			t.Errorf("Expected %d errors for %q, got %v", test.errs, test.doc, errs)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	typ, err := structOf([]byte(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := extract(typ, []byte("* Name* = John___[50]\n* Gender = () male (x) female\n* Clubs = [x] chess [x] band\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+  "Name": "John",
+  "Gender": "female",
+  "Clubs": [
+    "chess",
+    "band"
+  ],
+  "Biography": ""
+}`
+	if string(out) != expected {
+		t.Errorf("Unexpected JSON %s", out)
+	}
+
+	_, err = extract(typ, []byte("* Gender = (x) robot\n"))
+	if err == nil {
+		t.Errorf("Expected an error for an unknown option")
+	}
+}
+
+func TestFill(t *testing.T) {
+	typ, err := structOf([]byte(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := `# {{ markform . "Name" }}
+
+* {{ markform . "Gender" }}
+* {{ markform . "Clubs" }}
+`
+	out, err := fill(typ, tmpl, []byte(`{"Name": "John", "Gender": "male", "Clubs": ["band"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# Name* = John___[50]\n\n* Gender = (x) male () female\n* Clubs = [] chess [x] band\n"
+	if string(out) != expected {
+		t.Errorf("Unexpected document %q", out)
+	}
+
+	for _, input := range []string{`{"Gender": "robot"}`, `{"Clubs": ["golf"]}`, `{"Name": 1}`} {
+		_, err = fill(typ, tmpl, []byte(input))
+		if err == nil {
+			t.Errorf("Expected an error for %s", input)
+		}
+	}
+}
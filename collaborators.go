@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	collaboratorsMarkdown = template.Must(template.New("collaborators").Funcs(funcMap).Parse(
+		`# Collaborators
+
+Each list has the people and teams with that permission on the repository, teams are written
+as @org/team. Add someone to a list to invite them, move them to another list to change their
+permission or remove them to take away their access.
+
+* {{ markform .Form "Read" }}
+* {{ markform .Form "Triage" }}
+* {{ markform .Form "Write" }}
+* {{ markform .Form "Maintain" }}
+* {{ markform .Form "Admin" }}
+
+## Pending invitations
+
+People that were invited are in the lists above until they accept or the invitation is removed.
+
+{{ range .Invitations }}  * {{ .Invitee.GetLogin }} - {{ .GetPermissions }} - invited by {{ .Inviter.GetLogin }} on {{ .CreatedAt.Format "2006-01-02T15:04:05Z07:00" }}
+{{ else }}There are no pending invitations.
+{{ end }}`))
+)
+
+// permissionLevels are the permissions of a collaborator or team
+//  from the lowest to the highest along with what they are called
+//  in the API.
+var permissionLevels = []struct {
+	Field      string
+	Permission string
+	Invitation string
+}{
+	{"Read", "pull", "read"},
+	{"Triage", "triage", "triage"},
+	{"Write", "push", "write"},
+	{"Maintain", "maintain", "maintain"},
+	{"Admin", "admin", "admin"},
+}
+
+// CollaboratorsForm holds the people and teams with each permission
+type CollaboratorsForm struct {
+	Read     []string ` = ,, ___`
+	Triage   []string ` = ,, ___`
+	Write    []string ` = ,, ___`
+	Maintain []string ` = ,, ___`
+	Admin    []string ` = ,, ___`
+}
+
+// levels maps each person and team to the field of their permission
+func (f *CollaboratorsForm) levels() (map[string]string, error) {
+	levels := make(map[string]string)
+	lists := map[string][]string{"Read": f.Read, "Triage": f.Triage, "Write": f.Write, "Maintain": f.Maintain, "Admin": f.Admin}
+
+	for _, level := range permissionLevels {
+		for _, name := range lists[level.Field] {
+			if other, ok := levels[name]; ok {
+				return nil, fmt.Errorf("%s can't be in both %s and %s", name, other, level.Field)
+			}
+			levels[name] = level.Field
+		}
+	}
+
+	return levels, nil
+}
+
+// add adds a person or team to the list of a permission
+func (f *CollaboratorsForm) add(field string, name string) {
+	switch field {
+	case "Read":
+		f.Read = append(f.Read, name)
+	case "Triage":
+		f.Triage = append(f.Triage, name)
+	case "Write":
+		f.Write = append(f.Write, name)
+	case "Maintain":
+		f.Maintain = append(f.Maintain, name)
+	case "Admin":
+		f.Admin = append(f.Admin, name)
+	}
+}
+
+// CollaboratorsHandler handles the collaborators.md of a repository
+//  with the people, teams and invitations that have access to it.
+type CollaboratorsHandler struct {
+	Form        CollaboratorsForm
+	Invitations []*github.RepositoryInvitation
+
+	teams       map[string]int64
+	invitations map[string]int64
+	readbuf     *bytes.Buffer
+	writefid    protocol.FID
+	writebuf    *bytes.Buffer
+	mu          sync.Mutex
+}
+
+func NewCollaboratorsHandler(repoPath string) {
+	handler := &CollaboratorsHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(repoPath, "collaborators.md"), handler)
+	NewFormJSONHandler(path.Join(repoPath, "collaborators.json"), handler)
+}
+
+// permissionField is the field of the highest permission in a set
+//  of permissions or a single permission.
+func permissionField(permissions map[string]bool) string {
+	field := "Read"
+	for _, level := range permissionLevels {
+		if permissions[level.Permission] || permissions[level.Invitation] {
+			field = level.Field
+		}
+	}
+	return field
+}
+
+func (ch *CollaboratorsHandler) load(owner string, repo string) error {
+	form := CollaboratorsForm{[]string{}, []string{}, []string{}, []string{}, []string{}}
+	ch.teams = make(map[string]int64)
+	ch.invitations = make(map[string]int64)
+	ch.Invitations = []*github.RepositoryInvitation{}
+
+	options := &github.ListCollaboratorsOptions{Affiliation: "direct", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		log.Printf("Listing collaborators of %s/%s\n", owner, repo)
+		users, resp, err := uncachedClient.Repositories.ListCollaborators(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			permissions := map[string]bool{}
+			if user.Permissions != nil {
+				permissions = *user.Permissions
+			}
+			form.add(permissionField(permissions), user.GetLogin())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	listOptions := &github.ListOptions{PerPage: 100}
+	for {
+		log.Printf("Listing teams of %s/%s\n", owner, repo)
+		teams, resp, err := uncachedClient.Repositories.ListTeams(context.Background(), owner, repo, listOptions)
+		if err != nil {
+			return err
+		}
+
+		for _, team := range teams {
+			name := "@" + owner + "/" + team.GetSlug()
+			ch.teams[name] = team.GetID()
+			form.add(permissionField(map[string]bool{team.GetPermission(): true}), name)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOptions.Page = resp.NextPage
+	}
+
+	listOptions = &github.ListOptions{PerPage: 100}
+	for {
+		log.Printf("Listing invitations of %s/%s\n", owner, repo)
+		invitations, resp, err := uncachedClient.Repositories.ListInvitations(context.Background(), owner, repo, listOptions)
+		if err != nil {
+			return err
+		}
+
+		for _, invitation := range invitations {
+			login := invitation.GetInvitee().GetLogin()
+			ch.invitations[login] = invitation.GetID()
+			ch.Invitations = append(ch.Invitations, invitation)
+			form.add(permissionField(map[string]bool{invitation.GetPermissions(): true}), login)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOptions.Page = resp.NextPage
+	}
+
+	ch.Form = form
+	return nil
+}
+
+// teamID finds the ID of a team written as @org/team
+func (ch *CollaboratorsHandler) teamID(name string) (int64, error) {
+	if id, ok := ch.teams[name]; ok {
+		return id, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(name, "@"), "/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("Teams are written as @org/team, not %s", name)
+	}
+
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		log.Printf("Listing teams of %s\n", parts[0])
+		teams, resp, err := client.Teams.ListTeams(context.Background(), parts[0], options)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, team := range teams {
+			if team.GetSlug() == parts[1] {
+				return team.GetID(), nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	return 0, fmt.Errorf("Team %s not found", name)
+}
+
+func (ch *CollaboratorsHandler) loadForm(name string) (interface{}, error) {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	err := ch.load(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	form := ch.Form
+	return &form, nil
+}
+
+func (ch *CollaboratorsHandler) saveForm(name string, edited interface{}) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	return ch.save(owner, repo, edited.(*CollaboratorsForm))
+}
+
+// save invites, changes the permission of and removes the people
+//  and teams that were added, moved and removed from the lists.
+func (ch *CollaboratorsHandler) save(owner string, repo string, form *CollaboratorsForm) error {
+	before, err := ch.Form.levels()
+	if err != nil {
+		return err
+	}
+	after, err := form.levels()
+	if err != nil {
+		return err
+	}
+
+	permissions := make(map[string]string)
+	invitations := make(map[string]string)
+	for _, level := range permissionLevels {
+		permissions[level.Field] = level.Permission
+		invitations[level.Field] = level.Invitation
+	}
+
+	for name, field := range after {
+		if before[name] == field {
+			continue
+		}
+
+		if strings.HasPrefix(name, "@") {
+			id, err := ch.teamID(name)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Giving team %s %s permission on %s/%s\n", name, field, owner, repo)
+			_, err = client.Teams.AddTeamRepo(context.Background(), id, owner, repo, &github.TeamAddTeamRepoOptions{Permission: permissions[field]})
+			if err != nil {
+				return err
+			}
+		} else if id, ok := ch.invitations[name]; ok {
+			log.Printf("Changing the invitation of %s to %s permission on %s/%s\n", name, field, owner, repo)
+			_, _, err := client.Repositories.UpdateInvitation(context.Background(), owner, repo, id, invitations[field])
+			if err != nil {
+				return err
+			}
+		} else {
+			log.Printf("Giving %s %s permission on %s/%s\n", name, field, owner, repo)
+			_, err := client.Repositories.AddCollaborator(context.Background(), owner, repo, name, &github.RepositoryAddCollaboratorOptions{Permission: permissions[field]})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; ok {
+			continue
+		}
+
+		if strings.HasPrefix(name, "@") {
+			log.Printf("Removing team %s from %s/%s\n", name, owner, repo)
+			_, err := client.Teams.RemoveTeamRepo(context.Background(), ch.teams[name], owner, repo)
+			if err != nil {
+				return err
+			}
+		} else if id, ok := ch.invitations[name]; ok {
+			log.Printf("Removing the invitation of %s to %s/%s\n", name, owner, repo)
+			_, err := client.Repositories.DeleteInvitation(context.Background(), owner, repo, id)
+			if err != nil {
+				return err
+			}
+		} else {
+			log.Printf("Removing collaborator %s from %s/%s\n", name, owner, repo)
+			_, err := client.Repositories.RemoveCollaborator(context.Background(), owner, repo, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	ch.Form = *form
+
+	return nil
+}
+
+func (ch *CollaboratorsHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the collaborators.md file")
+}
+
+func (ch *CollaboratorsHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	err := ch.load(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err = collaboratorsMarkdown.Execute(&buf, ch)
+		if err != nil {
+			return err
+		}
+		ch.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if ch.writefid != 0 {
+			return fmt.Errorf("Collaborators don't support concurrent writes")
+		}
+
+		ch.writefid = fid
+		ch.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (ch *CollaboratorsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if offset >= int64(ch.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(ch.readbuf.Len()) {
+		return ch.readbuf.Bytes()[offset:], nil
+	}
+
+	return ch.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (ch *CollaboratorsHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if fid != ch.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := ch.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (ch *CollaboratorsHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a collaborators.md is not supported")
+}
+
+func (ch *CollaboratorsHandler) Stat(name string) (protocol.Dir, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(ch.readbuf.Len())}, nil
+}
+
+func (ch *CollaboratorsHandler) Wstat(name string, dir protocol.Dir) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.writebuf != nil {
+		ch.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (ch *CollaboratorsHandler) Remove(name string) error {
+	return fmt.Errorf("Removing collaborators.md isn't supported.")
+}
+
+func (ch *CollaboratorsHandler) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if fid != ch.writefid {
+		return nil
+	}
+	ch.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(ch.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &CollaboratorsForm{}
+	_, err := markform.Diff(&ch.Form, markform.Parse(ch.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return ch.save(owner, repo, form)
+}
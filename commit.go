@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sync"
+	"text/template"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	commitMarkdown = template.Must(template.New("commit").Funcs(funcMap).Parse(
+		`# Commit
+
+The message and author used for the next commit when a file in the tree directory is saved,
+created or removed. The message is only used once, after that it is cleared. When there is no
+message a default one that describes the change is used. The author is the authenticated user
+unless both the name and email are filled in.
+
+{{ markform . "Message" }}
+
+* {{ markform . "AuthorName" }}
+* {{ markform . "AuthorEmail" }}
+
+`))
+
+	commitCtls   = map[string]*CommitCtl{}
+	commitCtlsMu sync.Mutex
+)
+
+// CommitForm holds the details of the next commit to a repo
+type CommitForm struct {
+	Message     string ` = <<<`
+	AuthorName  string ` = ___`
+	AuthorEmail string ` = ___`
+}
+
+// CommitCtl handles the commit.md of a repo, which has the details
+//  of the next commit that is made through the filesystem.
+type CommitCtl struct {
+	Form CommitForm
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mutex    sync.Mutex
+}
+
+func NewCommitCtl(repoPath string) {
+	commitCtlsMu.Lock()
+	defer commitCtlsMu.Unlock()
+
+	if _, ok := commitCtls[repoPath]; ok {
+		return
+	}
+
+	handler := &CommitCtl{readbuf: &bytes.Buffer{}, writebuf: &bytes.Buffer{}}
+	commitCtls[repoPath] = handler
+	server.AddFileEntry(path.Join(repoPath, "commit.md"), handler)
+	NewFormJSONHandler(path.Join(repoPath, "commit.json"), handler)
+
+	commitMarkdown.Execute(handler.readbuf, handler.Form)
+}
+
+// nextCommit returns the message and author to use for the next commit
+//  to a repo, using the default message if none was provided. The
+//  message stays in the commit.md until commitMade is called so that
+//  it isn't lost when the commit fails.
+func nextCommit(owner string, repo string, defaultMessage string) (*string, *github.CommitAuthor) {
+	commitCtlsMu.Lock()
+	cc, ok := commitCtls[path.Join("/repos", owner, repo)]
+	commitCtlsMu.Unlock()
+
+	message := defaultMessage
+	if !ok {
+		return &message, nil
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if cc.Form.Message != "" {
+		message = cc.Form.Message
+	}
+
+	if cc.Form.AuthorName == "" || cc.Form.AuthorEmail == "" {
+		return &message, nil
+	}
+
+	name := cc.Form.AuthorName
+	email := cc.Form.AuthorEmail
+	return &message, &github.CommitAuthor{Name: &name, Email: &email}
+}
+
+// commitMade clears the message of the commit.md of a repo after a
+//  commit with it succeeds, unless it was changed in the meantime.
+func commitMade(owner string, repo string, message string) {
+	commitCtlsMu.Lock()
+	cc, ok := commitCtls[path.Join("/repos", owner, repo)]
+	commitCtlsMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if cc.Form.Message == message {
+		cc.Form.Message = ""
+	}
+}
+
+func (cc *CommitCtl) loadForm(name string) (interface{}, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	form := cc.Form
+	return &form, nil
+}
+
+func (cc *CommitCtl) saveForm(name string, edited interface{}) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.Form = *edited.(*CommitForm)
+	return nil
+}
+
+func (cc *CommitCtl) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the commit.md file")
+}
+
+func (cc *CommitCtl) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if cc.writefid != 0 {
+			return fmt.Errorf("Commit doesn't support concurrent writes")
+		}
+
+		cc.writefid = fid
+		cc.writebuf = &bytes.Buffer{}
+	}
+
+	if mode == protocol.OREAD {
+		cc.readbuf = &bytes.Buffer{}
+		commitMarkdown.Execute(cc.readbuf, cc.Form)
+	}
+
+	return nil
+}
+
+func (cc *CommitCtl) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a commit.md is not supported")
+}
+
+func (cc *CommitCtl) Stat(name string) (protocol.Dir, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(cc.readbuf.Len())}, nil
+}
+
+func (cc *CommitCtl) Wstat(name string, dir protocol.Dir) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.writebuf.Truncate(int(dir.Length))
+	return nil
+}
+
+func (cc *CommitCtl) Remove(name string) error {
+	return fmt.Errorf("Removing commit.md isn't supported.")
+}
+
+func (cc *CommitCtl) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if offset >= int64(cc.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(cc.readbuf.Len()) {
+		return cc.readbuf.Bytes()[offset:], nil
+	}
+
+	return cc.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (cc *CommitCtl) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if fid != cc.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := cc.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (cc *CommitCtl) Clunk(name string, fid protocol.FID) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if fid != cc.writefid {
+		return nil
+	}
+	cc.writefid = 0
+
+	if len(cc.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := CommitForm{}
+	err := markform.Unmarshal(markform.Parse(cc.writebuf.Bytes()), &form)
+	if err != nil {
+		return err
+	}
+
+	cc.Form = form
+	return nil
+}
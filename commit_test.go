@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNextCommit(t *testing.T) {
+	cc := &CommitCtl{Form: CommitForm{Message: "Fix the docs", AuthorName: "Jane", AuthorEmail: "jane@example.com"}}
+	commitCtlsMu.Lock()
+	commitCtls["/repos/owner/commit-test"] = cc
+	commitCtlsMu.Unlock()
+
+	message, author := nextCommit("owner", "commit-test", "Update README")
+	if *message != "Fix the docs" || author.GetName() != "Jane" || author.GetEmail() != "jane@example.com" {
+		t.Errorf("Unexpected commit %q by %v", *message, author)
+	}
+
+	// The message is kept for a retry until the commit is made
+	message, _ = nextCommit("owner", "commit-test", "Update README")
+	if *message != "Fix the docs" {
+		t.Errorf("Expected the message to be kept, got %q", *message)
+	}
+
+	commitMade("owner", "commit-test", "Fix the docs")
+	message, _ = nextCommit("owner", "commit-test", "Update README")
+	if *message != "Update README" {
+		t.Errorf("Expected the default message after the commit, got %q", *message)
+	}
+
+	// A message written while committing isn't cleared
+	cc.Form.Message = "Another change"
+	commitMade("owner", "commit-test", "Update README")
+	if cc.Form.Message != "Another change" {
+		t.Errorf("Expected the new message to be kept, got %q", cc.Form.Message)
+	}
+
+	message, author = nextCommit("owner", "no-commit-md", "Update README")
+	if *message != "Update README" || author != nil {
+		t.Errorf("Unexpected commit %q by %v without a commit.md", *message, author)
+	}
+}
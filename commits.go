@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	commitInfoMarkdown = template.Must(template.New("commitInfo").Funcs(funcMap).Parse(
+		`# Commit {{ .Commit.GetSHA }}
+
+* Author: {{ .Commit.Commit.Author.GetName }} <{{ .Commit.Commit.Author.GetEmail }}> {{ .Commit.Commit.Author.GetDate.Format "2006-01-02T15:04:05Z07:00" }}{{ with .Commit.Author }} [{{ .GetLogin }}](../../../{{ .GetLogin }}){{ end }}
+* Committer: {{ .Commit.Commit.Committer.GetName }} <{{ .Commit.Commit.Committer.GetEmail }}> {{ .Commit.Commit.Committer.GetDate.Format "2006-01-02T15:04:05Z07:00" }}
+* Parents: {{ range .Commit.Parents }}[{{ .GetSHA }}]({{ .GetSHA }}.md) {{ end }}
+* Checks: {{ .Checks.State }}{{ checks .Checks }}
+* Check output: [{{ .Commit.GetSHA }}/checks]({{ .Commit.GetSHA }}/checks)
+
+{{ markdown .Commit.Commit.GetMessage }}
+
+## Files
+
+{{ range .Commit.Files }}  * {{ .GetFilename }} [{{ .GetStatus }}] +{{ .GetAdditions }} -{{ .GetDeletions }}
+{{ end }}
+`))
+
+	commitsFilterMarkdown = template.Must(template.New("commitsFilter").Funcs(funcMap).Parse(
+		`# Filter
+
+Use this filter to control the commits of the default branch that are shown in this directory.
+Only the commits that change the path, that are written by the author or that are between the
+since and until times are shown.
+
+* {{ markform . "Path" }}
+* {{ markform . "Author" }}
+* {{ markform . "Since" }}
+* {{ markform . "Until" }}
+
+`))
+)
+
+// readRaw reads an API URL in one of the raw media types, such
+//  as the diff or patch of a commit.
+func readRaw(u string, mediaType string) ([]byte, error) {
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return []byte{}, err
+	}
+	req.Header.Set("Accept", mediaType)
+
+	buf := bytes.Buffer{}
+	_, err = client.Do(context.Background(), req, &buf)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// rawMediaTypes are the media types of the raw commit formats
+var rawMediaTypes = map[string]string{
+	".diff":  "application/vnd.github.v3.diff",
+	".patch": "application/vnd.github.v3.patch",
+}
+
+type CommitsFilter struct {
+	Path   string    ` = ___`
+	Author string    ` = ___`
+	Since  time.Time ` = 2006-01-02T15:04:05Z`
+	Until  time.Time ` = 2006-01-02T15:04:05Z`
+}
+
+// CommitsHandler handles the commits directory of a repository
+//  listing the recent commits of the default branch that match
+//  the filter.
+type CommitsHandler struct {
+	dynamic.BasicDirHandler
+	options *github.CommitsListOptions
+	filter  map[string]bool
+	mutex   sync.Mutex
+}
+
+func NewCommitsHandler(repoPath string) {
+	handler := &CommitsHandler{}
+	handler.options = &github.CommitsListOptions{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mutex.Lock()
+		defer handler.mutex.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(path.Join(repoPath, "commits"), handler)
+	NewCommitsCtl(path.Join(repoPath, "commits"), handler)
+}
+
+func (ch *CommitsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := ch.BasicDirHandler.WalkChild(name, child)
+
+	if _, ok := rawMediaTypes[path.Ext(child)]; idx == -1 && (ok || path.Ext(child) == ".md" || shaPattern.MatchString(child)) {
+		owner := path.Base(path.Dir(path.Dir(name)))
+		repo := path.Base(path.Dir(name))
+		sha := strings.TrimSuffix(child, path.Ext(child))
+
+		log.Printf("Checking if commit %s exists\n", sha)
+		commit, _, err := client.Repositories.GetCommit(context.Background(), owner, repo, sha)
+		if err != nil {
+			return -1, err
+		}
+
+		NewCommitHandler(path.Join(name, sha), commit)
+		return ch.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (ch *CommitsHandler) refresh(owner string, repo string) error {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	commitsPath := path.Join("/repos", owner, repo, "commits")
+	filter := make(map[string]bool)
+	filter[path.Join(commitsPath, "filter.md")] = true
+	filter[path.Join(commitsPath, "filter.json")] = true
+
+	// Only the most recent commits are shown
+	ch.options.ListOptions = github.ListOptions{PerPage: 50}
+
+	log.Printf("Listing commits for repo %s/%s\n", owner, repo)
+	commits, _, err := client.Repositories.ListCommits(context.Background(), owner, repo, ch.options)
+	if err != nil {
+		return err
+	}
+
+	for _, commit := range commits {
+		commitPath := path.Join(commitsPath, commit.GetSHA())
+		NewCommitHandler(commitPath, commit)
+		filter[commitPath] = true
+		filter[commitPath+".md"] = true
+		for ext := range rawMediaTypes {
+			filter[commitPath+ext] = true
+		}
+	}
+
+	ch.filter = filter
+
+	return nil
+}
+
+func (ch *CommitsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		repo := path.Base(path.Dir(name))
+		owner := path.Base(path.Dir(path.Dir(name)))
+		err := ch.refresh(owner, repo)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+	return ch.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// CommitsCtl handles the filter.md of the commits directory
+type CommitsCtl struct {
+	ch       *CommitsHandler
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mutex    sync.Mutex
+}
+
+func NewCommitsCtl(commitsPath string, ch *CommitsHandler) {
+	handler := &CommitsCtl{ch: ch, readbuf: &bytes.Buffer{}, writebuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(commitsPath, "filter.md"), handler)
+	NewFormJSONHandler(path.Join(commitsPath, "filter.json"), handler)
+
+	commitsFilterMarkdown.Execute(handler.readbuf, handler.filter())
+}
+
+// filter returns the current filter of the commits
+func (cc *CommitsCtl) filter() CommitsFilter {
+	return CommitsFilter{Path: cc.ch.options.Path, Author: cc.ch.options.Author, Since: cc.ch.options.Since, Until: cc.ch.options.Until}
+}
+
+// apply changes the commits filter and refreshes the commits
+func (cc *CommitsCtl) apply(name string, cf *CommitsFilter) error {
+	cc.ch.options.Path = cf.Path
+	cc.ch.options.Author = cf.Author
+	cc.ch.options.Since = cf.Since
+	cc.ch.options.Until = cf.Until
+
+	return cc.ch.refresh(path.Base(path.Dir(path.Dir(path.Dir(name)))), path.Base(path.Dir(path.Dir(name))))
+}
+
+func (cc *CommitsCtl) loadForm(name string) (interface{}, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cf := cc.filter()
+	return &cf, nil
+}
+
+func (cc *CommitsCtl) saveForm(name string, edited interface{}) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	return cc.apply(name, edited.(*CommitsFilter))
+}
+
+func (cc *CommitsCtl) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the commits filter.md file")
+}
+
+func (cc *CommitsCtl) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if cc.writefid != 0 {
+			return fmt.Errorf("Filter doesn't support concurrent writes")
+		}
+
+		cc.writefid = fid
+		cc.writebuf = &bytes.Buffer{}
+
+		commitsFilterMarkdown.Execute(cc.writebuf, cc.filter())
+	}
+
+	if mode == protocol.OREAD {
+		cc.readbuf = &bytes.Buffer{}
+
+		commitsFilterMarkdown.Execute(cc.readbuf, cc.filter())
+	}
+
+	return nil
+}
+
+func (cc *CommitsCtl) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a commits filter.md is not supported")
+}
+
+func (cc *CommitsCtl) Stat(name string) (protocol.Dir, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(cc.readbuf.Len())}, nil
+}
+
+func (cc *CommitsCtl) Wstat(name string, dir protocol.Dir) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.writebuf.Truncate(int(dir.Length))
+	return nil
+}
+
+func (cc *CommitsCtl) Remove(name string) error {
+	return fmt.Errorf("Removing commits filter.md isn't supported.")
+}
+
+func (cc *CommitsCtl) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if offset >= int64(cc.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(cc.readbuf.Len()) {
+		return cc.readbuf.Bytes()[offset:], nil
+	}
+
+	return cc.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (cc *CommitsCtl) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if fid != cc.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := cc.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (cc *CommitsCtl) Clunk(name string, fid protocol.FID) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if fid != cc.writefid {
+		return nil
+	}
+	cc.writefid = 0
+
+	if len(cc.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	cf := CommitsFilter{}
+	err := markform.Unmarshal(markform.Parse(cc.writebuf.Bytes()), &cf)
+	if err != nil {
+		return err
+	}
+
+	return cc.apply(name, &cf)
+}
+
+// CommitHandler handles the <sha>.md of a commit with its message,
+//  parents, changed files and checks. The diff and patch of the
+//  commit are in the <sha>.diff and <sha>.patch files. All of them
+//  have the time of the commit as their modification time. The
+//  <sha> directory has the output of the checks and a status.md.
+type CommitHandler struct {
+	dynamic.StaticFileHandler
+	Commit *github.RepositoryCommit
+	Checks *commitChecks
+
+	mtime time.Time
+	mu    sync.Mutex
+}
+
+func NewCommitHandler(commitPath string, commit *github.RepositoryCommit) {
+	mtime := commit.GetCommit().GetCommitter().GetDate()
+
+	server.AddFileEntry(commitPath+".md", &CommitHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}, mtime: mtime})
+	for ext := range rawMediaTypes {
+		server.AddFileEntry(commitPath+ext, &CommitRawHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}, mtime: mtime})
+	}
+	NewCommitDirHandler(commitPath)
+}
+
+func (ch *CommitHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	sha := strings.TrimSuffix(path.Base(name), path.Ext(name))
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	log.Printf("Reading commit %s of %s/%s\n", sha, owner, repo)
+	commit, _, err := client.Repositories.GetCommit(context.Background(), owner, repo, sha)
+	if err != nil {
+		return err
+	}
+	ch.Commit = commit
+	ch.mtime = commit.GetCommit().GetCommitter().GetDate()
+
+	ch.Checks = loadChecksForDisplay(owner, repo, sha)
+
+	buf := bytes.Buffer{}
+	err = commitInfoMarkdown.Execute(&buf, ch)
+	if err != nil {
+		return err
+	}
+
+	ch.StaticFileHandler.Content = buf.Bytes()
+
+	return ch.StaticFileHandler.Open(name, fid, mode)
+}
+
+func (ch *CommitHandler) Stat(name string) (protocol.Dir, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	dir, err := ch.StaticFileHandler.Stat(name)
+	dir.Mtime = unixTime(ch.mtime)
+	return dir, err
+}
+
+// CommitRawHandler handles the diff and patch files of a commit
+type CommitRawHandler struct {
+	dynamic.StaticFileHandler
+	mtime time.Time
+	mu    sync.Mutex
+}
+
+func (crh *CommitRawHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	ext := path.Ext(name)
+	sha := strings.TrimSuffix(path.Base(name), ext)
+
+	crh.mu.Lock()
+	defer crh.mu.Unlock()
+
+	log.Printf("Reading the %s of commit %s of %s/%s\n", ext[1:], sha, owner, repo)
+	content, err := readRaw(fmt.Sprintf("repos/%s/%s/commits/%s", owner, repo, sha), rawMediaTypes[ext])
+	if err != nil {
+		return err
+	}
+
+	crh.StaticFileHandler.Content = content
+
+	return crh.StaticFileHandler.Open(name, fid, mode)
+}
+
+func (crh *CommitRawHandler) Stat(name string) (protocol.Dir, error) {
+	crh.mu.Lock()
+	defer crh.mu.Unlock()
+
+	dir, err := crh.StaticFileHandler.Stat(name)
+	dir.Mtime = unixTime(crh.mtime)
+	return dir, err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+)
+
+var (
+	compareMarkdown = template.Must(template.New("compare").Funcs(funcMap).Parse(
+		`# Compare {{ .Base }}...{{ .Head }}
+
+* Status: {{ .Comparison.GetStatus }}
+* Ahead by: {{ .Comparison.GetAheadBy }}
+* Behind by: {{ .Comparison.GetBehindBy }}
+* Total commits: {{ .Comparison.GetTotalCommits }}
+
+## Commits
+
+{{ range .Comparison.Commits }}  * [{{ .GetSHA }}](../commits/{{ .GetSHA }}.md) {{ .Commit.Author.GetName }} - {{ summary .Commit.GetMessage }}
+{{ end }}
+## Files
+
+{{ range .Comparison.Files }}  * {{ .GetFilename }} [{{ .GetStatus }}] +{{ .GetAdditions }} -{{ .GetDeletions }}
+{{ end }}
+## Diff
+
+{{ markdown .Diff }}
+`))
+)
+
+// splitCompareName splits the name of a file in the compare
+//  directory, such as v1.0...main.diff, into its base and head refs.
+func splitCompareName(name string) (base string, head string, err error) {
+	fn := path.Base(name)
+	refs := strings.SplitN(strings.TrimSuffix(fn, path.Ext(fn)), "...", 2)
+	if len(refs) != 2 || refs[0] == "" || refs[1] == "" {
+		return "", "", fmt.Errorf("Compare files are named base...head.md, base...head.diff or base...head.patch")
+	}
+
+	return refName(refs[0]), refName(refs[1]), nil
+}
+
+// CompareHandler handles the compare directory of a repository. The
+//  comparisons aren't listed until they are looked up by name.
+type CompareHandler struct {
+	dynamic.BasicDirHandler
+}
+
+func NewCompareHandler(repoPath string) {
+	handler := &CompareHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, nil}
+
+	server.AddFileEntry(path.Join(repoPath, "compare"), handler)
+}
+
+func (ch *CompareHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := ch.BasicDirHandler.WalkChild(name, child)
+
+	if _, ok := rawMediaTypes[path.Ext(child)]; idx == -1 && (ok || path.Ext(child) == ".md") {
+		owner := path.Base(path.Dir(path.Dir(name)))
+		repo := path.Base(path.Dir(name))
+		base, head, err := splitCompareName(child)
+		if err != nil {
+			return -1, err
+		}
+
+		log.Printf("Comparing %s...%s in %s/%s\n", base, head, owner, repo)
+		_, _, err = client.Repositories.CompareCommits(context.Background(), owner, repo, base, head)
+		if err != nil {
+			return -1, err
+		}
+
+		comparePath := path.Join(name, strings.TrimSuffix(child, path.Ext(child)))
+		server.AddFileEntry(comparePath+".md", &CompareFileHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}})
+		for ext := range rawMediaTypes {
+			server.AddFileEntry(comparePath+ext, &CompareFileHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}})
+		}
+
+		return ch.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+// CompareFileHandler handles the markdown, diff and patch files of
+//  a comparison between two refs. The modification time is the time
+//  of the last commit in the comparison.
+type CompareFileHandler struct {
+	dynamic.StaticFileHandler
+	Base       string
+	Head       string
+	Comparison *github.CommitsComparison
+	Diff       string
+
+	mtime time.Time
+	mu    sync.Mutex
+}
+
+func (cfh *CompareFileHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	base, head, err := splitCompareName(name)
+	if err != nil {
+		return err
+	}
+
+	cfh.mu.Lock()
+	defer cfh.mu.Unlock()
+
+	log.Printf("Comparing %s...%s in %s/%s\n", base, head, owner, repo)
+	comparison, _, err := client.Repositories.CompareCommits(context.Background(), owner, repo, base, head)
+	if err != nil {
+		return err
+	}
+	cfh.Base = base
+	cfh.Head = head
+	cfh.Comparison = comparison
+	if len(comparison.Commits) != 0 {
+		cfh.mtime = comparison.Commits[len(comparison.Commits)-1].GetCommit().GetCommitter().GetDate()
+	}
+
+	mediaType, ok := rawMediaTypes[path.Ext(name)]
+	if !ok {
+		mediaType = rawMediaTypes[".diff"]
+	}
+
+	log.Printf("Reading the diff of %s...%s in %s/%s\n", base, head, owner, repo)
+	u := fmt.Sprintf("repos/%s/%s/compare/%s...%s", owner, repo, base, head)
+	content, err := readRaw(u, mediaType)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		cfh.StaticFileHandler.Content = content
+	} else {
+		cfh.Diff = string(content)
+
+		buf := bytes.Buffer{}
+		err = compareMarkdown.Execute(&buf, cfh)
+		if err != nil {
+			return err
+		}
+		cfh.StaticFileHandler.Content = buf.Bytes()
+	}
+
+	return cfh.StaticFileHandler.Open(name, fid, mode)
+}
+
+func (cfh *CompareFileHandler) Stat(name string) (protocol.Dir, error) {
+	cfh.mu.Lock()
+	defer cfh.mu.Unlock()
+
+	dir, err := cfh.StaticFileHandler.Stat(name)
+	dir.Mtime = unixTime(cfh.mtime)
+	return dir, err
+}
@@ -28,6 +28,12 @@ type FileHandler interface {
 	Clunk(name string, fid protocol.FID) error
 }
 
+// A directory creator is a file handler that supports the creation
+//  of child directories in addition to files.
+type DirCreator interface {
+	CreateDir(name string, child string) (int, error)
+}
+
 // A file entry is a location in the filesystem tree with a handler
 //  that handles the file operations for it. The server keeps track
 //  of the QID and FID's of the entries.
@@ -36,6 +42,7 @@ type FileEntry struct {
 	fids    []protocol.FID
 	Handler FileHandler
 	m       sync.Mutex
+	removed bool
 }
 
 func NewFileEntry(name string, handler FileHandler) FileEntry {
@@ -93,7 +100,7 @@ func (s *Server) MatchFile(matcher func(f *FileEntry) bool) int {
 	defer s.m.Unlock()
 
 	for idx := range s.files {
-		if matcher(&s.files[idx]) {
+		if !s.files[idx].removed && matcher(&s.files[idx]) {
 			return idx
 		}
 	}
@@ -108,7 +115,7 @@ func (s *Server) MatchFiles(matcher func(f *FileEntry) bool) []int {
 	files := []int{}
 
 	for idx := range s.files {
-		if matcher(&s.files[idx]) {
+		if !s.files[idx].removed && matcher(&s.files[idx]) {
 			files = append(files, idx)
 		}
 	}
@@ -123,6 +130,12 @@ func (s *Server) AddFileEntry(name string, handler FileHandler) int {
 
 	for idx := range s.files {
 		if s.files[idx].Name == newEntry.Name {
+			// Entries that were removed come back with the new handler
+			//  keeping the same QID path as before.
+			if s.files[idx].removed {
+				s.files[idx].Handler = newEntry.Handler
+				s.files[idx].removed = false
+			}
 			//s.files[idx].Handler = newEntry.Handler
 			return idx
 		}
@@ -133,12 +146,26 @@ func (s *Server) AddFileEntry(name string, handler FileHandler) int {
 
 }
 
+// RemoveFileEntry removes an entry and all of its children from the
+//  filesystem tree. The entries are only marked as removed so that
+//  the QID paths of the other entries remain valid.
+func (s *Server) RemoveFileEntry(name string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for idx := range s.files {
+		if s.files[idx].Name == name || strings.HasPrefix(s.files[idx].Name, name+"/") {
+			s.files[idx].removed = true
+		}
+	}
+}
+
 func (s *Server) HasChildren(name string) bool {
 	s.m.Lock()
 	defer s.m.Unlock()
 
 	for idx := range s.files {
-		if strings.HasPrefix(s.files[idx].Name, name+"/") {
+		if !s.files[idx].removed && strings.HasPrefix(s.files[idx].Name, name+"/") {
 			return true
 		}
 	}
@@ -244,18 +271,38 @@ func (s *Server) Rcreate(fid protocol.FID, name string, perm protocol.Perm, mode
 		return protocol.QID{}, 0, fmt.Errorf("File not found")
 	}
 
-	parent := s.files[idx]
-	idx, err := parent.Handler.CreateChild(parent.Name, name)
+	parent := &s.files[idx]
+	var cidx int
+	var err error
+	if perm&protocol.DMDIR != 0 {
+		dc, ok := parent.Handler.(DirCreator)
+		if !ok {
+			return protocol.QID{}, 0, fmt.Errorf("Creating directories is not supported")
+		}
+		cidx, err = dc.CreateDir(parent.Name, name)
+	} else {
+		cidx, err = parent.Handler.CreateChild(parent.Name, name)
+	}
 	if err != nil {
 		return protocol.QID{}, 0, err
 	}
 
-	child := s.files[idx]
+	// The fid now refers to the new child, which is opened
+	s.files[idx].removeFid(fid)
+	child := &s.files[cidx]
+	child.addFid(fid)
+
 	dir, err := child.Handler.Stat(child.Name)
 	if err != nil {
 		return protocol.QID{}, 0, err
 	}
-	dir.QID.Path = uint64(idx)
+	dir.QID.Path = uint64(cidx)
+
+	err = child.Handler.Open(child.Name, fid, mode)
+	if err != nil {
+		return protocol.QID{}, 0, err
+	}
+
 	return dir.QID, protocol.MaxSize(s.iounit), nil
 }
 
@@ -320,15 +367,34 @@ func (s *Server) Rwstat(fid protocol.FID, b []byte) error {
 }
 
 func (s *Server) Rremove(fid protocol.FID) error {
-	/*idx := s.MatchFile(func (f *FileEntry) bool { return f.hasFid(fid) })
-	  if idx == -1 {
-	          return fmt.Errorf("File not found")
-	  }
+	idx := s.MatchFile(func(f *FileEntry) bool { return f.hasFid(fid) })
+	if idx == -1 {
+		return fmt.Errorf("File not found")
+	}
+
+	// The fid is clunked even if the remove fails, letting the handler
+	//  finish any writes and release what it keeps for the fid.
+	f := &s.files[idx]
+	name, handler := f.Name, f.Handler
+	err := handler.Clunk(name, fid)
+	f = &s.files[idx]
+	f.removeFid(fid)
+	if err != nil {
+		return err
+	}
 
-	  f := s.files[idx]
-	  return f.Handler.Remove(f.Name)*/
+	// The handler may have already removed itself when it was clunked
+	if s.MatchFile(func(f *FileEntry) bool { return f.Name == name }) == -1 {
+		return nil
+	}
 
-	return fmt.Errorf("Remove is not supported since it would invalidate the existing QID's")
+	err = handler.Remove(name)
+	if err != nil {
+		return err
+	}
+
+	s.RemoveFileEntry(name)
+	return nil
 }
 
 func (s *Server) Rread(fid protocol.FID, o protocol.Offset, c protocol.Count) ([]byte, error) {
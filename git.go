@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+)
+
+var (
+	shaPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+	objectTypes   = map[string]string{}
+	objectTypesMu sync.Mutex
+)
+
+// splitGitPath splits the name of a file in the git directory of a
+//  repository into the owner and repo.
+func splitGitPath(name string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 4)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[1], parts[2]
+}
+
+// notFound reports whether the request failed because there is no
+//  such object, which GitHub reports as either a 404 or a 422.
+func notFound(resp *github.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity)
+}
+
+// signature formats the author or committer of a commit or tag the
+//  way that git does. GitHub doesn't keep the time zone so it's UTC.
+func signature(author *github.CommitAuthor) string {
+	return fmt.Sprintf("%s <%s> %d +0000", author.GetName(), author.GetEmail(), author.GetDate().Unix())
+}
+
+// recordObjectType remembers the type of an object that is known
+//  from a ref or another object that points to it, so that reading
+//  the object only needs the one request for that type.
+func recordObjectType(owner string, repo string, sha string, typ string) {
+	if sha == "" || typ == "" {
+		return
+	}
+
+	objectTypesMu.Lock()
+	defer objectTypesMu.Unlock()
+
+	objectTypes[owner+"/"+repo+"/"+sha] = typ
+}
+
+func objectType(owner string, repo string, sha string) string {
+	objectTypesMu.Lock()
+	defer objectTypesMu.Unlock()
+
+	return objectTypes[owner+"/"+repo+"/"+sha]
+}
+
+// commitObject formats a commit the way that git stores it
+func commitObject(commit *github.Commit) []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "tree %s\n", commit.GetTree().GetSHA())
+	for _, parent := range commit.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent.GetSHA())
+	}
+	fmt.Fprintf(&buf, "author %s\n", signature(commit.GetAuthor()))
+	fmt.Fprintf(&buf, "committer %s\n", signature(commit.GetCommitter()))
+	fmt.Fprintf(&buf, "\n%s", commit.GetMessage())
+	return buf.Bytes()
+}
+
+// treeObject formats a tree the way that git stores it, which is
+//  the mode and name of each entry followed by its binary SHA.
+func treeObject(tree *github.Tree) ([]byte, error) {
+	buf := bytes.Buffer{}
+	for _, entry := range tree.Entries {
+		sha, err := hex.DecodeString(entry.GetSHA())
+		if err != nil || len(sha) != 20 {
+			return []byte{}, fmt.Errorf("Tree entry %s has an invalid SHA %s", entry.GetPath(), entry.GetSHA())
+		}
+
+		// git doesn't pad the mode of a tree with a zero
+		fmt.Fprintf(&buf, "%s %s\x00", strings.TrimLeft(entry.GetMode(), "0"), entry.GetPath())
+		buf.Write(sha)
+	}
+	return buf.Bytes(), nil
+}
+
+// tagObject formats an annotated tag the way that git stores it
+func tagObject(tag *github.Tag) []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "object %s\n", tag.GetObject().GetSHA())
+	fmt.Fprintf(&buf, "type %s\n", tag.GetObject().GetType())
+	fmt.Fprintf(&buf, "tag %s\n", tag.GetTag())
+	fmt.Fprintf(&buf, "tagger %s\n", signature(tag.GetTagger()))
+	fmt.Fprintf(&buf, "\n%s", tag.GetMessage())
+	return buf.Bytes()
+}
+
+// readTypedObject reads an object of a known type in the format
+//  that git stores it, without the header of the type and size.
+//  The types of the objects that it points to are remembered.
+func readTypedObject(owner string, repo string, sha string, typ string) ([]byte, *github.Response, error) {
+	log.Printf("Reading %s object %s of %s/%s\n", typ, sha, owner, repo)
+
+	switch typ {
+	case "commit":
+		commit, resp, err := client.Git.GetCommit(context.Background(), owner, repo, sha)
+		if err != nil {
+			return []byte{}, resp, err
+		}
+		recordObjectType(owner, repo, commit.GetTree().GetSHA(), "tree")
+		for _, parent := range commit.Parents {
+			recordObjectType(owner, repo, parent.GetSHA(), "commit")
+		}
+		return commitObject(commit), resp, nil
+	case "tree":
+		tree, resp, err := client.Git.GetTree(context.Background(), owner, repo, sha, false)
+		if err != nil {
+			return []byte{}, resp, err
+		}
+		for _, entry := range tree.Entries {
+			recordObjectType(owner, repo, entry.GetSHA(), entry.GetType())
+		}
+		content, err := treeObject(tree)
+		return content, resp, err
+	case "blob":
+		return client.Git.GetBlobRaw(context.Background(), owner, repo, sha)
+	case "tag":
+		tag, resp, err := client.Git.GetTag(context.Background(), owner, repo, sha)
+		if err != nil {
+			return []byte{}, resp, err
+		}
+		recordObjectType(owner, repo, tag.GetObject().GetSHA(), tag.GetObject().GetType())
+		return tagObject(tag), resp, nil
+	}
+
+	return []byte{}, nil, fmt.Errorf("Unknown type %s of object %s", typ, sha)
+}
+
+// readObject reads a git object in the format that git stores it,
+//  as shown by git cat-file with the type of the object. The type
+//  is known when the object was reached from a ref or another
+//  object, otherwise each type is tried until one is found.
+//  GitHub doesn't keep the time zones or signatures of commits and
+//  tags so they don't always hash to their SHA.
+func readObject(owner string, repo string, sha string) ([]byte, error) {
+	if typ := objectType(owner, repo, sha); typ != "" {
+		content, _, err := readTypedObject(owner, repo, sha, typ)
+		return content, err
+	}
+
+	for _, typ := range []string{"commit", "tree", "blob"} {
+		content, resp, err := readTypedObject(owner, repo, sha, typ)
+		if err == nil || !notFound(resp) {
+			return content, err
+		}
+	}
+
+	content, _, err := readTypedObject(owner, repo, sha, "tag")
+	return content, err
+}
+
+// NewGitHandler adds the git directory of a repository with the refs
+//  and objects of the git data API.
+func NewGitHandler(repoPath string) {
+	gitPath := path.Join(repoPath, "git")
+	server.AddFileEntry(gitPath, &dynamic.BasicDirHandler{server, nil})
+	server.AddFileEntry(path.Join(gitPath, "refs"), &dynamic.BasicDirHandler{server, nil})
+	NewRefsHandler(path.Join(gitPath, "refs", "heads"))
+	NewRefsHandler(path.Join(gitPath, "refs", "tags"))
+
+	handler := &ObjectsHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, nil}
+	server.AddFileEntry(path.Join(gitPath, "objects"), handler)
+}
+
+// RefsHandler handles the refs/heads or refs/tags directory, which
+//  has a file for each ref with the SHA that it points to. New refs
+//  are made by creating new files in the directory.
+type RefsHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewRefsHandler(refsPath string) {
+	handler := &RefsHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(refsPath, handler)
+}
+
+func (rh *RefsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := rh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		owner, repo := splitGitPath(name)
+		ref := path.Base(name) + "/" + refName(child)
+
+		log.Printf("Reading ref %s of %s/%s\n", ref, owner, repo)
+		r, _, err := client.Git.GetRef(context.Background(), owner, repo, ref)
+		if err != nil {
+			return -1, err
+		}
+
+		recordObjectType(owner, repo, r.GetObject().GetSHA(), r.GetObject().GetType())
+		return rh.add(path.Join(name, child), r.GetObject().GetSHA()), nil
+	}
+
+	return idx, err
+}
+
+// add adds the file of a ref to the directory
+func (rh *RefsHandler) add(refPath string, sha string) int {
+	idx := NewRefHandler(refPath, sha)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if rh.filter != nil {
+		rh.filter[refPath] = true
+	}
+	return idx
+}
+
+func (rh *RefsHandler) refresh(name string) error {
+	owner, repo := splitGitPath(name)
+
+	filter := make(map[string]bool)
+	options := &github.ReferenceListOptions{Type: path.Base(name), ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		log.Printf("Listing %s refs of %s/%s\n", options.Type, owner, repo)
+		refs, resp, err := uncachedClient.Git.ListRefs(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range refs {
+			refPath := path.Join(name, refFileName(strings.TrimPrefix(ref.GetRef(), "refs/"+options.Type+"/")))
+			NewRefHandler(refPath, ref.GetObject().GetSHA())
+			recordObjectType(owner, repo, ref.GetObject().GetSHA(), ref.GetObject().GetType())
+			filter[refPath] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	rh.mu.Lock()
+	rh.filter = filter
+	rh.mu.Unlock()
+
+	return nil
+}
+
+func (rh *RefsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := rh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return rh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (rh *RefsHandler) CreateChild(name string, child string) (int, error) {
+	childPath := path.Join(name, child)
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return idx, nil
+	}
+
+	// The ref is created when the SHA is written to it
+	return rh.add(childPath, ""), nil
+}
+
+// RefHandler handles the file of a ref, which has the SHA of the
+//  object that it points to. Writing a new SHA to the file updates
+//  the ref as long as it's a fast-forward. Put a + in front of the
+//  SHA to force the update, like git push does.
+type RefHandler struct {
+	sha string
+
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewRefHandler(refPath string, sha string) int {
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool {
+		if f.Name != refPath {
+			return false
+		}
+
+		if rh, ok := f.Handler.(*RefHandler); ok && sha != "" {
+			rh.mu.Lock()
+			rh.sha = sha
+			rh.mu.Unlock()
+		}
+		return true
+	})
+
+	if idx == -1 {
+		idx = server.AddFileEntry(refPath, &RefHandler{sha: sha})
+	}
+	return idx
+}
+
+// content is the SHA of the ref as it is read from the file
+func (rh *RefHandler) content() []byte {
+	if rh.sha == "" {
+		return []byte{}
+	}
+	return []byte(rh.sha + "\n")
+}
+
+func (rh *RefHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of a ref")
+}
+
+func (rh *RefHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo := splitGitPath(name)
+	ref := path.Base(path.Dir(name)) + "/" + refName(path.Base(name))
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if mode == protocol.OREAD && rh.sha != "" {
+		log.Printf("Reading ref %s of %s/%s\n", ref, owner, repo)
+		r, _, err := uncachedClient.Git.GetRef(context.Background(), owner, repo, ref)
+		if err != nil {
+			return err
+		}
+		rh.sha = r.GetObject().GetSHA()
+		recordObjectType(owner, repo, rh.sha, r.GetObject().GetType())
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if rh.writefid != 0 {
+			return fmt.Errorf("Ref %s doesn't support concurrent writes", ref)
+		}
+
+		rh.writefid = fid
+		rh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (rh *RefHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	content := rh.content()
+	if offset >= int64(len(content)) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(len(content)) {
+		return content[offset:], nil
+	}
+
+	return content[offset : offset+count], nil
+}
+
+func (rh *RefHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if fid != rh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := rh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (rh *RefHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a ref is not supported")
+}
+
+func (rh *RefHandler) Stat(name string) (protocol.Dir, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(len(rh.content()))}, nil
+}
+
+func (rh *RefHandler) Wstat(name string, dir protocol.Dir) error {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if rh.writebuf != nil {
+		rh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (rh *RefHandler) Remove(name string) error {
+	owner, repo := splitGitPath(name)
+	ref := path.Base(path.Dir(name)) + "/" + refName(path.Base(name))
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	// A ref that was never created only needs to be forgotten
+	if rh.sha == "" {
+		return nil
+	}
+
+	log.Printf("Deleting ref %s of %s/%s\n", ref, owner, repo)
+	_, err := client.Git.DeleteRef(context.Background(), owner, repo, ref)
+	if err != nil {
+		return err
+	}
+	rh.sha = ""
+
+	return nil
+}
+
+func (rh *RefHandler) Clunk(name string, fid protocol.FID) error {
+	owner, repo := splitGitPath(name)
+	ref := "refs/" + path.Base(path.Dir(name)) + "/" + refName(path.Base(name))
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if fid != rh.writefid {
+		return nil
+	}
+	rh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	value := strings.TrimSpace(rh.writebuf.String())
+	if value == "" {
+		return nil
+	}
+
+	force := strings.HasPrefix(value, "+")
+	sha := strings.TrimPrefix(value, "+")
+	if !shaPattern.MatchString(sha) {
+		return fmt.Errorf("Write the full SHA of a commit to %s, with a + in front of it to force the update", path.Base(name))
+	}
+
+	if sha == rh.sha {
+		return nil
+	}
+
+	r := &github.Reference{Ref: &ref, Object: &github.GitObject{SHA: &sha}}
+	if rh.sha == "" {
+		log.Printf("Creating ref %s at %s in %s/%s\n", ref, sha, owner, repo)
+		_, _, err := client.Git.CreateRef(context.Background(), owner, repo, r)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Updating ref %s from %s to %s in %s/%s\n", ref, rh.sha, sha, owner, repo)
+		_, resp, err := client.Git.UpdateRef(context.Background(), owner, repo, r, force)
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity && !force {
+			return fmt.Errorf("Updating %s to %s isn't a fast-forward, write +%s to force it", ref, sha, sha)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	rh.sha = sha
+
+	return nil
+}
+
+// ObjectsHandler handles the objects directory of a repository.
+//  The objects aren't listed until they are looked up by their SHA.
+type ObjectsHandler struct {
+	dynamic.BasicDirHandler
+}
+
+func (oh *ObjectsHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := oh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && shaPattern.MatchString(child) {
+		owner, repo := splitGitPath(name)
+
+		// Objects never change so they are only read once
+		content, err := readObject(owner, repo, child)
+		if err != nil {
+			return -1, err
+		}
+
+		return server.AddFileEntry(path.Join(name, child), &dynamic.StaticFileHandler{content}), nil
+	}
+
+	return idx, err
+}
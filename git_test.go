@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestTreeObject(t *testing.T) {
+	blob := "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+	tree := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+	content, err := treeObject(&github.Tree{Entries: []github.TreeEntry{
+		{Path: github.String("README"), Mode: github.String("100644"), Type: github.String("blob"), SHA: &blob},
+		{Path: github.String("docs"), Mode: github.String("040000"), Type: github.String("tree"), SHA: &tree},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobSHA, _ := hex.DecodeString(blob)
+	treeSHA, _ := hex.DecodeString(tree)
+	expected := append([]byte("100644 README\x00"), blobSHA...)
+	expected = append(expected, []byte("40000 docs\x00")...)
+	expected = append(expected, treeSHA...)
+	if !bytes.Equal(content, expected) {
+		t.Errorf("Unexpected tree %q", content)
+	}
+
+	_, err = treeObject(&github.Tree{Entries: []github.TreeEntry{{Path: github.String("bad"), Mode: github.String("100644"), SHA: github.String("xyz")}}})
+	if err == nil {
+		t.Errorf("Expected an error for an invalid SHA")
+	}
+}
+
+func TestCommitObject(t *testing.T) {
+	when := time.Unix(1500000000, 0)
+	author := &github.CommitAuthor{Name: github.String("Jane"), Email: github.String("jane@example.com"), Date: &when}
+
+	commit := &github.Commit{
+		Tree:      &github.Tree{SHA: github.String("4b825dc642cb6eb9a060e54bf8d69288fbee4904")},
+		Parents:   []github.Commit{{SHA: github.String("1111111111111111111111111111111111111111")}},
+		Author:    author,
+		Committer: author,
+		Message:   github.String("Fix it\n"),
+	}
+
+	expected := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 1111111111111111111111111111111111111111\n" +
+		"author Jane <jane@example.com> 1500000000 +0000\n" +
+		"committer Jane <jane@example.com> 1500000000 +0000\n" +
+		"\nFix it\n"
+	if string(commitObject(commit)) != expected {
+		t.Errorf("Unexpected commit %q", commitObject(commit))
+	}
+}
+
+func TestObjectType(t *testing.T) {
+	sha := "2222222222222222222222222222222222222222"
+	if objectType("owner", "repo", sha) != "" {
+		t.Errorf("Expected an unknown type")
+	}
+
+	recordObjectType("owner", "repo", sha, "tree")
+	recordObjectType("owner", "repo", "", "blob")
+	recordObjectType("owner", "other", sha, "")
+	if objectType("owner", "repo", sha) != "tree" {
+		t.Errorf("Expected the recorded type, got %q", objectType("owner", "repo", sha))
+	}
+	if objectType("owner", "other", sha) != "" {
+		t.Errorf("Expected the type to be recorded for one repo")
+	}
+}
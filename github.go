@@ -19,7 +19,8 @@ import (
 var (
 	client         *github.Client
 	uncachedClient *github.Client
-	funcMap        = map[string]interface{}{"markdown": markdown, "markform": markform.Marshal}
+	apiTransport   = http.DefaultTransport
+	funcMap        = map[string]interface{}{"checks": checkList, "markdown": markdown, "markform": markform.Marshal, "summary": summary}
 	currentUser    string
 	ntype          = flag.String("ntype", "tcp4", "Default network type")
 	naddr          = flag.String("addr", ":5640", "Network address")
@@ -32,6 +33,23 @@ func markdown(content string) string {
 	return "    " + strings.Replace(content, "\n", "\n    ", -1)
 }
 
+// summary is the first line of a commit message
+func summary(message string) string {
+	return strings.SplitN(message, "\n", 2)[0]
+}
+
+// apiRequest sends a request to the parts of the API that go-github
+//  doesn't have yet, such as webhook deliveries and actions.
+func apiRequest(method string, u string, body interface{}, v interface{}) error {
+	req, err := client.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Do(context.Background(), req, v)
+	return err
+}
+
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	flag.Parse()
@@ -46,6 +64,7 @@ func main() {
 
 		tc := oauth2.NewClient(context.Background(), authTs.Source)
 		uncachedClient = github.NewClient(tc)
+		apiTransport = &authTs
 
 		cu, _, err := client.Users.Get(context.Background(), "")
 		if err != nil {
@@ -76,10 +95,100 @@ Welcome to a file system view of GitHub. Using the site is easy once you learn a
 
 Files are rendered in Markdown or even simple text so that you can interact with it using simple text editors.
 
+The repo.md file of a repository has its description, topics and settings, such as its visibility, default
+branch and the ways that pull requests can be merged. Change them and save the file to update the repository.
+
+Making a new directory in "_ghfs_/repos/_owner_", where the owner is you or one of your organizations, makes a
+repo.md in it with the settings of a new repository, such as its description, visibility and whether it starts
+with a README. Saving it creates the repository with that name. The repo.md file in each repository can fork, archive or delete it once you type
+the full name of the repository into its Confirm field.
+
+Who has access to a repository is in its collaborators.md file, with a list of the people and teams for each
+permission. Add someone to a list to invite them, move them to another list to change their permission or remove
+them to take their access away. Pending invitations are shown at the end.
+
+Milestones are in "_ghfs_/repos/_owner_/_repo_/milestones" with an N.md for each one. It shows the due date, how many
+issues are open and closed with a progress bar and the issues in the milestone. Edit the title, state, due date or
+description and save the file to update it. Creating a new file, such as new.md, and saving it creates a milestone.
+
+The labels of a repository are a table in its labels.md file with the name, color and description of each one.
+Add, change or remove rows and save the file to create, update or delete labels. Fill in the name of another
+repository in the CopyFrom field to copy its labels so that your projects use the same ones.
+
+The webhooks of a repository are in its hooks directory with an N.md for each one, where you can change the URL,
+content type, events and whether it's active. The secret is never shown, fill it in to change it. The recent
+deliveries are listed with their status codes and checking them sends them again. Create a new file, such as
+new.md, to add a webhook and remove the file to delete it. Organizations have their webhooks in the same way in
+"_ghfs_/repos/_org_/0hooks".
+
+GitHub Actions are in the actions directory of each repository. The workflows directory has a file for each
+workflow, such as ci.md for ci.yml, with its recent runs and a form to dispatch it on a branch with inputs. The
+runs directory has a directory for each recent run, or any run by its ID, with a run.md showing its status,
+conclusion, trigger, branch, duration, jobs and artifacts. Choose an action in run.md and save it to rerun the run,
+rerun the failed jobs or cancel it. The log of each job is in the jobs directory and the artifacts can be copied
+from the artifacts directory.
+
 For each repo the open issues are shown under "_ghfs_/repos/_owner_/_repo_/issues". In that directory there is a
 filter.md file that you can modify to change the issue filters. When you refresh the directory listing only the
 issues matching the filter are shown.
 
+Pull requests are in "_ghfs_/repos/_owner_/_repo_/pulls" with a filter.md and 0list.md just like the issues.
+Each pull request has an N.md where you can edit its title, body, state, base, draft, labels and reviewers and
+add comments, as well as N.diff, N.patch and N.files with the changed files. To merge a pull request choose
+merge, squash or rebase in its N.md and save it. To create a pull request fill in the new.md file, or any
+other new file in the pulls directory, and save it. The pull request then shows up as N.md.
+
+To review a pull request open its N.review file, which has the diff with the review comments quoted under the
+lines that they are about. Add comments in multi-line Comment blocks under the lines of the diff, choose whether
+to comment, approve or request changes at the end, write a summary and save it to submit the review.
+
+The files of a repository can be found in "_ghfs_/repos/_owner_/_repo_/tree/_branch_" so that you can read
+the code without cloning it. Slashes in branch names are shown as "%2F". Saving, creating or removing a file
+in there makes a commit to the branch. The message and author of the next commit can be set in the commit.md
+file of the repo, otherwise a message describing the change is used. If the file was changed on GitHub since
+you last read it the save fails so that the other changes aren't lost.
+
+Each branch has a file in "_ghfs_/repos/_owner_/_repo_/branches" with its head commit, protection and how far
+it is ahead or behind the default branch. Create a new file named after a branch, fill in where it starts from
+and save it to create the branch. To delete a branch check the Delete box in its file, save it and remove it.
+
+The recent commits of the default branch are in "_ghfs_/repos/_owner_/_repo_/commits" with a _sha_.md file
+showing the message, parents, changed files and status checks of each one as well as _sha_.diff and _sha_.patch
+files. The filter.md file there limits the commits to a path, an author or a range of time.
+
+The checks of a commit are its statuses and check runs, each with its state, summary and details link. They are
+shown in _sha_.md, on the Commit line of repo.md and in the N.md of pull requests. The _sha_ directory next to
+_sha_.md has a checks directory with the output of each check run and a status.md file. Fill in the context,
+state, description and target URL of status.md and save it to post a status on the commit, which is handy for bots.
+
+To see what changed between two tags, branches or commits look up a file such as "v1.0...main.md" in
+"_ghfs_/repos/_owner_/_repo_/compare". It lists the commits and changed files followed by the diff.
+The "v1.0...main.diff" and "v1.0...main.patch" files have just the diff or the patches.
+
+Releases are directories named after their tags in "_ghfs_/repos/_owner_/_repo_/releases". The release.md file
+in each one has the name, notes, target and whether it is a draft or prerelease. Check GenerateNotes and save
+it to replace the notes with a summary of the changes since the previous release. The assets of the release are
+the other files in the directory. Copy a file into the directory to upload it and remove it to delete the asset.
+Making a new directory publishes a release of the tag with that name, creating the tag if it doesn't exist.
+To fill in the release first, create a release.md in the releases directory and save it with the tag. Checking
+GenerateNotes in it publishes the release with notes generated by GitHub.
+
+Each release and each branch, in "_ghfs_/repos/_owner_/_repo_/branches/_branch_", has archive.tar.gz and archive.zip
+files with a snapshot of its source. They are downloaded from GitHub as they are read, so copying them with cp is
+all it takes to get the source without cloning the repo.
+
+Tools that work with git directly can use "_ghfs_/repos/_owner_/_repo_/git". The files in refs/heads and
+refs/tags have the SHA of each branch and tag. Writing a SHA to one of them moves the ref if it is a fast-forward,
+put a "+" in front of the SHA to force it like git push does. Creating a new file there creates a ref and
+removing one deletes it. Any object can be read from objects/_sha_ as git stores it, the same as "git cat-file"
+with the type of the object. GitHub doesn't keep the time zones or signatures of commits and tags so those may not
+hash to their SHA. Objects found through a ref or another object are read in one request.
+
+To contribute a change without cloning a repo write a unified diff, or the mbox made by "git format-patch",
+to "_ghfs_/repos/_owner_/_repo_/patches/new". The patches are applied to a new branch off the default branch with
+a commit for each one and a pull request can be opened from the branch. Read the file again to see the branch
+and pull request that were made, or the hunk that didn't apply.
+
 ## Markform
 
 Various files are modifiable using "markform", which is a format built on top of markdown for highlighting
@@ -118,7 +227,10 @@ Delete the x from the default and put it in the option that you want.
 Education = () elementary (x) hig school () post-secondary
 
 There are also check box groups, which work much the same as the radios except that you can put an "x"
-on all of the options you want or remove them the ones you don't want.
+on all of the options you want or remove them the ones you don't want. The options of some radios and
+check box groups come from GitHub, such as the labels of an issue, which are the repository's labels.
+
+Labels = [x] bug [] enhancement [] question
 
 Lists look something like this.
 
@@ -129,11 +241,27 @@ Just type in your new elements or remove existing elements.
 
 Labels = ,, enhancement ,, ___
 
+Longer text that can span many lines, such as the body of an issue or a comment, is written between
+a line that ends with three angle brackets and a name, and a line with only that name on it.
+
+Body = <<<EOF
+Here is my excellent description!
+
+It can have *markdown*, code blocks and anything else that you want.
+EOF
+
+Everything between those two lines is kept exactly as you wrote it.
+
 Date fields are shown in an RFC3339 (or ISO-8601) format that you can modify to specify the date that you
 would like.
 
 StartDate = 2010-01-02T15:04:05Z
 
+Each markform file has a JSON file beside it with the same name, such as repo.json next to repo.md,
+that has the same fields for use in scripts and other tools. Writing a JSON object to it saves the
+changes in the same way as saving the markform file. Fields that are missing from the object are left
+as they are.
+
 That's about all there is to know about markform. The format is designed to be readable, make it clear
 the expected format and make it easy to modify.
 
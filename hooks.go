@@ -0,0 +1,573 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	hookMarkdown = template.Must(template.New("hook").Funcs(funcMap).Parse(
+		`{{ if .Hook }}# Webhook {{ .Hook.GetID }}
+{{ else }}# New webhook
+
+Fill in the webhook and save this file to create it. It then shows up as N.md.
+{{ end }}
+* {{ markform .Form "URL" }}
+* {{ markform .Form "ContentType" }}
+* {{ markform .Form "Active" }}
+* {{ markform .Form "Events" }}
+
+The secret is never shown. Fill it in to change the secret of the webhook.
+
+* {{ markform .Form "Secret" }}
+{{ if .Hook }}
+## Recent deliveries
+
+{{ range .Deliveries }}  * {{ .ID }} {{ .Event }}{{ if .Action }}.{{ .Action }}{{ end }} - {{ .StatusCode }} {{ .Status }} - {{ .DeliveredAt.Format "2006-01-02T15:04:05Z07:00" }}{{ if .Redelivery }} (redelivery){{ end }}
+{{ else }}There are no recent deliveries.
+{{ end }}
+Check deliveries to send them again.
+
+* {{ markform .Form "Redeliver" }}
+{{ end }}`))
+
+	// hookEvents are the events that webhooks are commonly sent for,
+	//  "*" is every event.
+	hookEvents = []string{"*", "push", "create", "delete", "pull_request", "pull_request_review", "pull_request_review_comment", "issues", "issue_comment", "commit_comment", "label", "milestone", "release", "status", "check_run", "check_suite", "workflow_run", "deployment", "deployment_status", "fork", "watch", "member", "public", "repository", "gollum", "organization", "team"}
+)
+
+// hookDelivery is a delivery of a webhook, which go-github doesn't
+//  have yet.
+type hookDelivery struct {
+	ID          int64     `json:"id"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	Redelivery  bool      `json:"redelivery"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code"`
+	Event       string    `json:"event"`
+	Action      string    `json:"action"`
+}
+
+// hooksBase is the API path that the webhooks of a repository or an
+//  organization are under. Organization webhooks are in the 0hooks
+//  directory of the owner so that they don't clash with a repository.
+func hooksBase(dir string) string {
+	if path.Base(dir) == "0hooks" {
+		return "orgs/" + path.Base(path.Dir(dir))
+	}
+	return strings.TrimPrefix(path.Dir(dir), "/")
+}
+
+// hookID is the ID of the webhook in a file name like 123.md
+func hookID(name string) (int64, error) {
+	base := path.Base(name)
+	return strconv.ParseInt(strings.TrimSuffix(base, path.Ext(base)), 10, 64)
+}
+
+// HooksHandler handles the directory of the webhooks of a repository
+//  or an organization with a markform file for each webhook. New
+//  webhooks are added by creating new files in the directory.
+type HooksHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewHooksHandler(hooksPath string) {
+	handler := &HooksHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(hooksPath, handler)
+}
+
+func (hh *HooksHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := hh.BasicDirHandler.WalkChild(name, child)
+
+	if id, e := hookID(child); idx == -1 && e == nil {
+		log.Printf("Checking if webhook %d of %s exists\n", id, hooksBase(name))
+		err = apiRequest("GET", fmt.Sprintf("%s/hooks/%d", hooksBase(name), id), nil, &github.Hook{})
+		if err != nil {
+			return -1, err
+		}
+
+		hh.add(path.Join(name, strconv.FormatInt(id, 10)))
+		return hh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+// add adds the files of an existing webhook to the directory
+func (hh *HooksHandler) add(hookPath string) {
+	NewHookHandler(hh, hookPath)
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if hh.filter != nil {
+		hh.filter[hookPath+".md"] = true
+		hh.filter[hookPath+".json"] = true
+	}
+}
+
+func (hh *HooksHandler) refresh(name string) error {
+	base := hooksBase(name)
+	filter := make(map[string]bool)
+
+	for page := 1; page != 0; {
+		log.Printf("Listing webhooks of %s\n", base)
+		hooks := []*github.Hook{}
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s/hooks?per_page=100&page=%d", base, page), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(context.Background(), req, &hooks)
+		if err != nil {
+			return err
+		}
+
+		for _, hook := range hooks {
+			hookPath := path.Join(name, strconv.FormatInt(hook.GetID(), 10))
+			NewHookHandler(hh, hookPath)
+			filter[hookPath+".md"] = true
+			filter[hookPath+".json"] = true
+		}
+
+		page = resp.NextPage
+	}
+
+	hh.mu.Lock()
+	previous := hh.filter
+	hh.mu.Unlock()
+
+	// Keep the new webhooks that haven't been saved yet
+	for fn := range previous {
+		if filter[fn] {
+			continue
+		}
+
+		var hook *HookHandler
+		server.MatchFile(func(f *dynamic.FileEntry) bool {
+			if f.Name != fn {
+				return false
+			}
+			hook, _ = f.Handler.(*HookHandler)
+			return true
+		})
+		if hook != nil && hook.isNew() {
+			filter[fn] = true
+		}
+	}
+
+	hh.mu.Lock()
+	hh.filter = filter
+	hh.mu.Unlock()
+
+	return nil
+}
+
+func (hh *HooksHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := hh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return hh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (hh *HooksHandler) CreateChild(name string, child string) (int, error) {
+	if _, err := hookID(child); err == nil || path.Ext(child) != ".md" {
+		return -1, fmt.Errorf("New webhooks are created with a file such as new.md")
+	}
+
+	childPath := path.Join(name, child)
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return idx, nil
+	}
+
+	handler := &HookHandler{hh: hh, created: true, readbuf: &bytes.Buffer{}}
+	handler.Form = HookForm{ContentType: "json", Active: true, Events: []string{"push"}}
+	handler.Form.withEvents()
+	err := hookMarkdown.Execute(handler.readbuf, handler)
+	if err != nil {
+		return -1, err
+	}
+	idx = server.AddFileEntry(childPath, handler)
+
+	hh.mu.Lock()
+	if hh.filter != nil {
+		hh.filter[childPath] = true
+	}
+	hh.mu.Unlock()
+
+	return idx, nil
+}
+
+// HookForm holds the editable fields of a webhook. The secret is
+//  never shown so it's only changed when it's filled in. Checking
+//  deliveries in Redeliver sends them again.
+type HookForm struct {
+	URL         string   ` = ___`
+	ContentType string   ` = () json () form`
+	Active      bool     ` = []`
+	Events      []string ` = [] ...`
+	Secret      string   ` = ___`
+	Redeliver   []string ` = [] ...`
+
+	events     []string
+	deliveries []string
+}
+
+func (f HookForm) Options(fn string) []string {
+	switch fn {
+	case "Events":
+		return f.events
+	case "Redeliver":
+		return f.deliveries
+	}
+	return nil
+}
+
+// HookHandler handles the markform file of a webhook with its recent
+//  deliveries. Webhooks that are created don't have an ID yet so they
+//  are saved to create the webhook and then removed.
+type HookHandler struct {
+	Hook       *github.Hook
+	Deliveries []hookDelivery
+	Form       HookForm
+
+	hh       *HooksHandler
+	created  bool
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewHookHandler(hh *HooksHandler, hookPath string) {
+	handler := &HookHandler{hh: hh, readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(hookPath+".md", handler)
+	NewFormJSONHandler(hookPath+".json", handler)
+}
+
+// isNew reports whether the webhook still needs to be created
+func (hh *HookHandler) isNew() bool {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	return hh.created
+}
+
+// withEvents adds the events of the webhook to the options of the form
+func (f *HookForm) withEvents() {
+	known := make(map[string]bool)
+	f.events = []string{}
+	for _, event := range append(hookEvents, f.Events...) {
+		if !known[event] {
+			known[event] = true
+			f.events = append(f.events, event)
+		}
+	}
+}
+
+func (hh *HookHandler) load(name string) error {
+	base := hooksBase(path.Dir(name))
+	id, err := hookID(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reading webhook %d of %s\n", id, base)
+	hook := &github.Hook{}
+	err = apiRequest("GET", fmt.Sprintf("%s/hooks/%d", base, id), nil, hook)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Listing the deliveries of webhook %d of %s\n", id, base)
+	deliveries := []hookDelivery{}
+	err = apiRequest("GET", fmt.Sprintf("%s/hooks/%d/deliveries?per_page=20", base, id), nil, &deliveries)
+	if err != nil {
+		return err
+	}
+
+	form := HookForm{URL: fmt.Sprint(hook.Config["url"]), ContentType: "form", Active: hook.GetActive(), Events: hook.Events, Redeliver: []string{}}
+	if hook.Config["content_type"] == "json" {
+		form.ContentType = "json"
+	}
+	form.withEvents()
+	form.deliveries = []string{}
+	for _, delivery := range deliveries {
+		form.deliveries = append(form.deliveries, strconv.FormatInt(delivery.ID, 10))
+	}
+
+	hh.Hook = hook
+	hh.Deliveries = deliveries
+	hh.Form = form
+
+	return nil
+}
+
+func (hh *HookHandler) loadForm(name string) (interface{}, error) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if !hh.created {
+		err := hh.load(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	form := hh.Form
+	return &form, nil
+}
+
+func (hh *HookHandler) saveForm(name string, edited interface{}) error {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	form := edited.(*HookForm)
+	return hh.save(name, markform.Compare(&hh.Form, form), form)
+}
+
+// save creates the webhook if it is new, otherwise the changes of
+//  the edited form are applied to the webhook and the checked
+//  deliveries are sent again.
+func (hh *HookHandler) save(name string, changes markform.Changes, form *HookForm) error {
+	base := hooksBase(path.Dir(name))
+
+	config := map[string]interface{}{}
+	if hh.created || changes.Has("URL") {
+		if strings.TrimSpace(form.URL) == "" {
+			return fmt.Errorf("The URL of the webhook is required")
+		}
+		config["url"] = form.URL
+	}
+	if hh.created || changes.Has("ContentType") {
+		config["content_type"] = form.ContentType
+	}
+	if form.Secret != "" {
+		config["secret"] = form.Secret
+	}
+
+	if hh.created {
+		if len(form.Events) == 0 {
+			return fmt.Errorf("Webhooks need at least one event")
+		}
+
+		log.Printf("Creating webhook for %s in %s\n", form.URL, base)
+		hook := &github.Hook{Name: github.String("web"), Config: config, Events: form.Events, Active: &form.Active}
+		err := apiRequest("POST", base+"/hooks", hook, hook)
+		if err != nil {
+			return err
+		}
+
+		hh.hh.add(path.Join(path.Dir(name), strconv.FormatInt(hook.GetID(), 10)))
+		server.RemoveFileEntry(name)
+		return nil
+	}
+
+	id, err := hookID(name)
+	if err != nil {
+		return err
+	}
+
+	if len(config) != 0 {
+		log.Printf("Editing the configuration of webhook %d of %s\n", id, base)
+		err = apiRequest("PATCH", fmt.Sprintf("%s/hooks/%d/config", base, id), config, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if changes.Has("Active") || changes.Has("Events") {
+		if len(form.Events) == 0 {
+			return fmt.Errorf("Webhooks need at least one event")
+		}
+
+		log.Printf("Editing webhook %d of %s\n", id, base)
+		edit := &github.Hook{Events: form.Events, Active: &form.Active}
+		err = apiRequest("PATCH", fmt.Sprintf("%s/hooks/%d", base, id), edit, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, delivery := range form.Redeliver {
+		log.Printf("Redelivering %s of webhook %d of %s\n", delivery, id, base)
+		err = apiRequest("POST", fmt.Sprintf("%s/hooks/%d/deliveries/%s/attempts", base, id, delivery), nil, nil)
+		if _, ok := err.(*github.AcceptedError); err != nil && !ok {
+			return err
+		}
+	}
+
+	form.Secret = ""
+	form.Redeliver = []string{}
+	hh.Form = *form
+
+	return nil
+}
+
+func (hh *HookHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of a webhook")
+}
+
+func (hh *HookHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if !hh.created {
+		err := hh.load(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err := hookMarkdown.Execute(&buf, hh)
+		if err != nil {
+			return err
+		}
+		hh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if hh.writefid != 0 {
+			return fmt.Errorf("Webhook doesn't support concurrent writes")
+		}
+
+		hh.writefid = fid
+		hh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (hh *HookHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if offset >= int64(hh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(hh.readbuf.Len()) {
+		return hh.readbuf.Bytes()[offset:], nil
+	}
+
+	return hh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (hh *HookHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if fid != hh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := hh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (hh *HookHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a webhook is not supported")
+}
+
+func (hh *HookHandler) Stat(name string) (protocol.Dir, error) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(hh.readbuf.Len())}, nil
+}
+
+func (hh *HookHandler) Wstat(name string, dir protocol.Dir) error {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if hh.writebuf != nil {
+		hh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (hh *HookHandler) Remove(name string) error {
+	base := hooksBase(path.Dir(name))
+
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	// A webhook that was never created only needs to be forgotten
+	if hh.created {
+		return nil
+	}
+
+	id, err := hookID(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Deleting webhook %d of %s\n", id, base)
+	err = apiRequest("DELETE", fmt.Sprintf("%s/hooks/%d", base, id), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	server.RemoveFileEntry(strings.TrimSuffix(name, path.Ext(name)) + ".json")
+	return nil
+}
+
+func (hh *HookHandler) Clunk(name string, fid protocol.FID) error {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if fid != hh.writefid {
+		return nil
+	}
+	hh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(hh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &HookForm{}
+	changes, err := markform.Diff(&hh.Form, markform.Parse(hh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return hh.save(name, changes, form)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"path"
-	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -114,7 +113,7 @@ func NewIssuesHandler(repoPath string) {
 func (ih *IssuesHandler) WalkChild(name string, child string) (int, error) {
 	idx, _ := ih.BasicDirHandler.WalkChild(name, child)
 	if idx == -1 {
-		number, err := strconv.Atoi(strings.Replace(child, ".md", "", 1))
+		number, err := issueNumber(child)
 		if err != nil {
 			return idx, fmt.Errorf("Issue %s not found", child)
 		}
@@ -161,6 +160,7 @@ func (ih *IssuesHandler) refresh(owner string, repo string) error {
 	ih.options.ListOptions = github.ListOptions{PerPage: 1}
 	ih.filter = make(map[string]bool)
 	ih.filter["/repos/"+owner+"/"+repo+"/issues/filter.md"] = true
+	ih.filter["/repos/"+owner+"/"+repo+"/issues/filter.json"] = true
 	ih.filter["/repos/"+owner+"/"+repo+"/issues/0list.md"] = true
 
 	for {
@@ -172,6 +172,7 @@ func (ih *IssuesHandler) refresh(owner string, repo string) error {
 		for _, issue := range issues {
 			NewIssue(server, owner, repo, issue)
 			ih.filter[fmt.Sprintf("/repos/%s/%s/issues/%d.md", owner, repo, *issue.Number)] = true
+			ih.filter[fmt.Sprintf("/repos/%s/%s/issues/%d.json", owner, repo, *issue.Number)] = true
 		}
 
 		if resp.NextPage == 0 {
@@ -211,16 +212,50 @@ type IssuesCtl struct {
 func NewIssuesCtl(server *dynamic.Server, issuesPath string, ih *IssuesHandler) {
 	handler := &IssuesCtl{ih: ih, readbuf: &bytes.Buffer{}, writebuf: &bytes.Buffer{}}
 	server.AddFileEntry(path.Join(issuesPath, "filter.md"), handler)
+	NewFormJSONHandler(path.Join(issuesPath, "filter.json"), handler)
 
+	issueFilterMarkdown.Execute(handler.readbuf, handler.filter())
+}
+
+// filter returns the current filter of the issues
+func (ic *IssuesCtl) filter() IssuesFilter {
 	isf := IssuesFilter{}
-	isf.Mentioned = handler.ih.options.Mentioned
-	isf.State = handler.ih.options.State
-	isf.Assignee = handler.ih.options.Assignee
-	isf.Creator = handler.ih.options.Creator
-	isf.Labels = handler.ih.options.Labels
-	isf.Since = handler.ih.options.Since
+	isf.Milestone = ic.ih.options.Milestone
+	isf.Mentioned = ic.ih.options.Mentioned
+	isf.State = ic.ih.options.State
+	isf.Assignee = ic.ih.options.Assignee
+	isf.Creator = ic.ih.options.Creator
+	isf.Labels = ic.ih.options.Labels
+	isf.Since = ic.ih.options.Since
+	return isf
+}
+
+// apply changes the issues filter and refreshes the issues
+func (ic *IssuesCtl) apply(name string, isf *IssuesFilter) error {
+	ic.ih.options.Milestone = isf.Milestone
+	ic.ih.options.State = isf.State
+	ic.ih.options.Assignee = isf.Assignee
+	ic.ih.options.Creator = isf.Creator
+	ic.ih.options.Mentioned = isf.Mentioned
+	ic.ih.options.Labels = isf.Labels
+	ic.ih.options.Since = isf.Since
+
+	return ic.ih.refresh(path.Base(path.Dir(path.Dir(path.Dir(name)))), path.Base(path.Dir(path.Dir(name))))
+}
 
-	issueFilterMarkdown.Execute(handler.readbuf, isf)
+func (ic *IssuesCtl) loadForm(name string) (interface{}, error) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	isf := ic.filter()
+	return &isf, nil
+}
+
+func (ic *IssuesCtl) saveForm(name string, edited interface{}) error {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	return ic.apply(name, edited.(*IssuesFilter))
 }
 
 func (ic *IssuesCtl) WalkChild(name string, child string) (int, error) {
@@ -239,29 +274,13 @@ func (ic *IssuesCtl) Open(name string, fid protocol.FID, mode protocol.Mode) err
 		ic.writefid = fid
 		ic.writebuf = &bytes.Buffer{}
 
-		isf := IssuesFilter{}
-		isf.Mentioned = ic.ih.options.Mentioned
-		isf.State = ic.ih.options.State
-		isf.Assignee = ic.ih.options.Assignee
-		isf.Creator = ic.ih.options.Creator
-		isf.Labels = ic.ih.options.Labels
-		isf.Since = ic.ih.options.Since
-
-		issueFilterMarkdown.Execute(ic.writebuf, isf)
+		issueFilterMarkdown.Execute(ic.writebuf, ic.filter())
 	}
 
 	if mode == protocol.OREAD {
 		ic.readbuf = &bytes.Buffer{}
 
-		isf := IssuesFilter{}
-		isf.Mentioned = ic.ih.options.Mentioned
-		isf.State = ic.ih.options.State
-		isf.Assignee = ic.ih.options.Assignee
-		isf.Creator = ic.ih.options.Creator
-		isf.Labels = ic.ih.options.Labels
-		isf.Since = ic.ih.options.Since
-
-		issueFilterMarkdown.Execute(ic.readbuf, isf)
+		issueFilterMarkdown.Execute(ic.readbuf, ic.filter())
 	}
 
 	return nil
@@ -337,42 +356,74 @@ func (ic *IssuesCtl) Clunk(name string, fid protocol.FID) error {
 	}
 
 	isf := IssuesFilter{}
-	md := blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode))
-	tree := md.Parse(ic.writebuf.Bytes())
+	tree := markform.Parse(ic.writebuf.Bytes())
 	err := markform.Unmarshal(tree, &isf)
 	if err != nil {
 		return err
 	}
 
-	ic.ih.options.Milestone = isf.Milestone
-	ic.ih.options.State = isf.State
-	ic.ih.options.Assignee = isf.Assignee
-	ic.ih.options.Creator = isf.Creator
-	ic.ih.options.Mentioned = isf.Mentioned
-	ic.ih.options.Labels = isf.Labels
-	ic.ih.options.Since = isf.Since
-
-	return ic.ih.refresh(path.Base(path.Dir(path.Dir(path.Dir(name)))), path.Base(path.Dir(path.Dir(name))))
+	return ic.apply(name, &isf)
 }
 
 type Comment struct {
 	Comment *github.IssueComment
 	Form    struct {
-		Body string ` = ___`
+		Body string ` = <<<`
+	}
+}
+
+// IssueForm holds the editable fields of an issue. The
+//  labels that can be chosen are the repository's labels.
+type IssueForm struct {
+	Title    string   ` = ___`
+	Assignee string   ` = ___`
+	State    string   ` = () open () closed`
+	Labels   []string ` = [] ...`
+	Body     string   ` = <<<`
+
+	repoLabels []string
+}
+
+func (f IssueForm) Options(fn string) []string {
+	if fn == "Labels" {
+		if f.repoLabels == nil {
+			return []string{}
+		}
+		return f.repoLabels
+	}
+	return nil
+}
+
+// repoLabels lists the names of all of the labels defined in a repository.
+func repoLabels(owner string, repo string) ([]string, error) {
+	labels := []string{}
+	options := &github.ListOptions{PerPage: 100}
+
+	for {
+		log.Printf("Listing labels for repo %s/%s\n", owner, repo)
+		ls, resp, err := client.Issues.ListLabels(context.Background(), owner, repo, options)
+		if err != nil {
+			return labels, err
+		}
+
+		for _, l := range ls {
+			labels = append(labels, l.GetName())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
 	}
+
+	return labels, nil
 }
 
 type Issue struct {
 	mtime    time.Time
 	Issue    *github.Issue
 	Comments []Comment
-	Form     struct {
-		Title    string   ` = ___`
-		Assignee string   ` = ___`
-		State    string   ` = () open () closed`
-		Labels   []string ` = ,, ___`
-		Body     string   ` = ___`
-	}
+	Form     IssueForm
 
 	readbuf  *bytes.Buffer
 	writefid protocol.FID
@@ -394,6 +445,124 @@ func NewIssue(server *dynamic.Server, owner string, repo string, i *github.Issue
 	}
 
 	server.AddFileEntry(path.Join("/repos", owner, repo, "issues", fmt.Sprintf("%d.md", *i.Number)), issue)
+	NewFormJSONHandler(path.Join("/repos", owner, repo, "issues", fmt.Sprintf("%d.json", *i.Number)), issue)
+}
+
+// issueNumber parses the issue number from the name of its file
+func issueNumber(name string) (int, error) {
+	fn := path.Base(name)
+	return strconv.Atoi(strings.TrimSuffix(fn, path.Ext(fn)))
+}
+
+func (i *Issue) load(owner string, repo string, n int) error {
+	log.Printf("Loading issue %d\n", n)
+	issue, _, err := uncachedClient.Issues.Get(context.Background(), owner, repo, n)
+	if err != nil {
+		return err
+	}
+	i.mtime = issue.GetUpdatedAt()
+	i.Issue = issue
+
+	i.Form.Title = *issue.Title
+	i.Form.Assignee = ""
+	if issue.Assignee != nil {
+		i.Form.Assignee = *issue.Assignee.Login
+	}
+	i.Form.State = *issue.State
+	i.Form.Body = issue.GetBody()
+	i.Form.repoLabels, err = repoLabels(owner, repo)
+	if err != nil {
+		return err
+	}
+	i.Form.Labels = []string{}
+	if issue.Labels != nil {
+		for _, l := range issue.Labels {
+			i.Form.Labels = append(i.Form.Labels, *l.Name)
+
+			found := false
+			for _, rl := range i.Form.repoLabels {
+				if rl == *l.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				i.Form.repoLabels = append(i.Form.repoLabels, *l.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (i *Issue) loadForm(name string) (interface{}, error) {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	n, err := issueNumber(name)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	err = i.load(owner, repo, n)
+	if err != nil {
+		return nil, err
+	}
+
+	form := i.Form
+	return &form, nil
+}
+
+func (i *Issue) saveForm(name string, edited interface{}) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	n, err := issueNumber(name)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	form := edited.(*IssueForm)
+	return i.save(owner, repo, n, markform.Compare(&i.Form, form), form)
+}
+
+// save applies the changes of the edited form to the issue in a single edit
+func (i *Issue) save(owner string, repo string, n int, changes markform.Changes, form *IssueForm) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	req := &github.IssueRequest{}
+	for _, c := range changes {
+		log.Printf("Changing %s of issue %d from %v to %v\n", c.Field, n, c.Old, c.New)
+	}
+	if changes.Has("Title") {
+		req.Title = &form.Title
+	}
+	if changes.Has("Body") {
+		req.Body = &form.Body
+	}
+	if changes.Has("State") {
+		req.State = &form.State
+	}
+	if changes.Has("Labels") {
+		req.Labels = &form.Labels
+	}
+	if changes.Has("Assignee") {
+		req.Assignee = &form.Assignee
+	}
+
+	_, _, err := client.Issues.Edit(context.Background(), owner, repo, n, req)
+	if err != nil {
+		return err
+	}
+	i.Form = *form
+
+	return nil
 }
 
 func (i *Issue) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
@@ -435,8 +604,7 @@ func (i *Issue) WalkChild(name string, child string) (int, error) {
 func (i *Issue) Open(name string, fid protocol.FID, mode protocol.Mode) error {
 	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
 	repo := path.Base(path.Dir(path.Dir(name)))
-	fn := path.Base(name)
-	n, err := strconv.Atoi(strings.Replace(fn, ".md", "", 1))
+	n, err := issueNumber(name)
 	if err != nil {
 		return err
 	}
@@ -444,70 +612,22 @@ func (i *Issue) Open(name string, fid protocol.FID, mode protocol.Mode) error {
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
 
-	if mode == protocol.OREAD {
+	if mode == protocol.OREAD || i.Issue == nil {
 		i.readbuf.Truncate(0)
-		log.Printf("Loading issue %d\n", n)
-		issue, _, err := uncachedClient.Issues.Get(context.Background(), owner, repo, n)
+		err = i.load(owner, repo, n)
 		if err != nil {
 			return err
 		}
-		i.mtime = issue.GetUpdatedAt()
-		i.Issue = issue
-
-		i.Form.Title = *issue.Title
-		i.Form.Assignee = ""
-		if issue.Assignee != nil {
-			i.Form.Assignee = *issue.Assignee.Login
-		}
-		i.Form.State = *issue.State
-		if issue.Body != nil {
-			i.Form.Body = "\n```\n" + *issue.Body + "\n```\n"
-		} else {
-			i.Form.Body = "\n```\n\n```\n"
-		}
-		i.Form.Labels = []string{}
-		if issue.Labels != nil {
-			for _, l := range issue.Labels {
-				i.Form.Labels = append(i.Form.Labels, *l.Name)
-			}
-		}
 
 		err = issueMarkdown.Execute(i.readbuf, i)
 		if err != nil {
 			return err
 		}
 
-		i.Comments = []Comment{}
-		log.Printf("Listing comments for issue %d\n", n)
-		comments, _, err := uncachedClient.Issues.ListComments(context.Background(), owner, repo, n, nil)
-		for idx, comment := range comments {
-			if i.mtime.Before(comment.GetUpdatedAt()) {
-				i.mtime = comment.GetUpdatedAt()
-			}
-
-			i.Comments = append(i.Comments, Comment{})
-			i.Comments[idx].Comment = comment
-			i.Comments[idx].Form.Body = "\n```\n" + *comment.Body + "\n```\n"
-
-			bb := bytes.Buffer{}
-			err := commentMarkdown.Execute(&bb, i.Comments[idx])
-			if err != nil {
-				return err
-			}
-			i.readbuf.Write(bb.Bytes())
-		}
-
-		// Comment template
-		commentTemplate := Comment{}
-		commentTemplate.Form.Body = "\n```\n\n```\n"
-		i.Comments = append(i.Comments, commentTemplate)
-
-		bb := bytes.Buffer{}
-		err = commentMarkdown.Execute(&bb, commentTemplate)
+		i.Comments, err = loadComments(owner, repo, n, &i.mtime, i.readbuf)
 		if err != nil {
 			return err
 		}
-		i.readbuf.Write(bb.Bytes())
 	}
 
 	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
@@ -554,8 +674,7 @@ func (i *Issue) Remove(name string) error {
 func (i *Issue) Clunk(name string, fid protocol.FID) error {
 	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
 	repo := path.Base(path.Dir(path.Dir(name)))
-	fn := path.Base(name)
-	n, err := strconv.Atoi(strings.Replace(fn, ".md", "", 1))
+	n, err := issueNumber(name)
 	if err != nil {
 		return err
 	}
@@ -573,11 +692,70 @@ func (i *Issue) Clunk(name string, fid protocol.FID) error {
 		return nil
 	}
 
-	newi := &Issue{}
-	md := blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode))
-	tree := md.Parse(i.writebuf.Bytes())
+	form := &IssueForm{}
+	tree := markform.Parse(i.writebuf.Bytes())
+	comments := splitComments(tree)
+
+	changes, err := markform.Diff(&i.Form, tree, form)
+	if err != nil {
+		return err
+	}
+
+	err = i.save(owner, repo, n, changes, form)
+	if err != nil {
+		return err
+	}
+
+	i.Comments, err = saveComments(owner, repo, n, i.Comments, comments)
+	return err
+}
+
+// loadComments lists the comments of an issue or pull request rendering
+//  them to the buffer followed by an empty one for adding a new comment.
+//  The modification time is moved forward to the latest comment.
+func loadComments(owner string, repo string, n int, mtime *time.Time, buf *bytes.Buffer) ([]Comment, error) {
+	result := []Comment{}
+	log.Printf("Listing comments for issue %d\n", n)
+	comments, _, err := uncachedClient.Issues.ListComments(context.Background(), owner, repo, n, nil)
+	if err != nil {
+		return result, err
+	}
 
-	// Split out the comments into their own documents
+	for idx, comment := range comments {
+		if mtime.Before(comment.GetUpdatedAt()) {
+			*mtime = comment.GetUpdatedAt()
+		}
+
+		result = append(result, Comment{})
+		result[idx].Comment = comment
+		result[idx].Form.Body = comment.GetBody()
+
+		bb := bytes.Buffer{}
+		err := commentMarkdown.Execute(&bb, result[idx])
+		if err != nil {
+			return result, err
+		}
+		buf.Write(bb.Bytes())
+	}
+
+	// Comment template
+	commentTemplate := Comment{}
+	result = append(result, commentTemplate)
+
+	bb := bytes.Buffer{}
+	err = commentMarkdown.Execute(&bb, commentTemplate)
+	if err != nil {
+		return result, err
+	}
+	buf.Write(bb.Bytes())
+
+	return result, nil
+}
+
+// splitComments splits the comments out of a written document into
+//  their own documents. Each comment starts with a heading after the
+//  first one, the rest of the document remains in the tree.
+func splitComments(tree *blackfriday.Node) []*blackfriday.Node {
 	newparent := tree
 	comments := []*blackfriday.Node{}
 
@@ -601,86 +779,48 @@ func (i *Issue) Clunk(name string, fid protocol.FID) error {
 
 	newparent.LastChild = node
 
-	err = markform.Unmarshal(tree, &newi.Form)
-	if err != nil {
-		return err
-	}
-
-	// TODO collapse these individual edits into one
-
-	if newi.Form.Body != i.Form.Body {
-		log.Printf("Setting issue body for %d\n", n)
-		_, _, err := client.Issues.Edit(context.Background(), owner, repo, n, &github.IssueRequest{Body: &newi.Form.Body})
-		if err != nil {
-			return err
-		}
-	}
-
-	if newi.Form.Title != i.Form.Title {
-		log.Printf("Setting issue title for %d\n", n)
-		_, _, err := client.Issues.Edit(context.Background(), owner, repo, n, &github.IssueRequest{Title: &newi.Form.Title})
-		if err != nil {
-			return err
-		}
-	}
-
-	if newi.Form.State != i.Form.State {
-		log.Printf("Changing issue state for %d\n", n)
-		_, _, err := client.Issues.Edit(context.Background(), owner, repo, n, &github.IssueRequest{State: &newi.Form.State})
-		if err != nil {
-			return err
-		}
-	}
-
-	if !reflect.DeepEqual(newi.Form.Labels, i.Form.Labels) {
-		log.Printf("Changing labels for %d\n", n)
-		_, _, err := client.Issues.Edit(context.Background(), owner, repo, n, &github.IssueRequest{Labels: &newi.Form.Labels})
-		if err != nil {
-			return err
-		}
-	}
-
-	if newi.Form.Assignee != i.Form.Assignee {
-		log.Printf("Assigning issue %d\n", n)
-		_, _, err = client.Issues.Edit(context.Background(), owner, repo, n, &github.IssueRequest{Assignee: &newi.Form.Assignee})
-		if err != nil {
-			return err
-		}
-	}
+	return comments
+}
 
+// saveComments creates the new comments and edits the changed ones
+//  of an issue or pull request returning the updated comments.
+func saveComments(owner string, repo string, n int, existing []Comment, comments []*blackfriday.Node) ([]Comment, error) {
 	for idx, c := range comments {
 		comment := &Comment{}
-		markform.Unmarshal(c, &comment.Form)
+		err := markform.Unmarshal(c, &comment.Form)
+		if err != nil {
+			return existing, err
+		}
 
 		// New comment
-		if len(i.Comments) <= idx && len(strings.TrimSpace(comment.Form.Body)) != 0 {
+		if len(existing) <= idx && len(strings.TrimSpace(comment.Form.Body)) != 0 {
 			log.Printf("Creating a comment for issue %d\n", n)
 			gc, _, err := client.Issues.CreateComment(context.Background(), owner, repo, n, &github.IssueComment{Body: &comment.Form.Body})
 			if err != nil {
-				return err
+				return existing, err
 			}
-			i.Comments = append(i.Comments, Comment{Comment: gc})
-			i.Comments[idx].Form.Body = comment.Form.Body
-		} else if i.Comments[idx].Form.Body == "\n```\n\n```\n" && len(strings.TrimSpace(comment.Form.Body)) != 0 {
+			existing = append(existing, Comment{Comment: gc})
+			existing[len(existing)-1].Form.Body = comment.Form.Body
+		} else if idx < len(existing) && existing[idx].Comment == nil && len(strings.TrimSpace(comment.Form.Body)) != 0 {
 			log.Printf("Creating a comment for issue %d\n", n)
 			gc, _, err := client.Issues.CreateComment(context.Background(), owner, repo, n, &github.IssueComment{Body: &comment.Form.Body})
 			if err != nil {
-				return err
+				return existing, err
 			}
-			i.Comments[idx].Comment = gc
-			i.Comments[idx].Form.Body = comment.Form.Body
+			existing[idx].Comment = gc
+			existing[idx].Form.Body = comment.Form.Body
 			// Edit existing comment
-		} else if i.Comments[idx].Form.Body != comment.Form.Body && i.Comments[idx].Form.Body != "\n```\n\n```\n" {
+		} else if idx < len(existing) && existing[idx].Comment != nil && existing[idx].Form.Body != comment.Form.Body {
 			log.Printf("Editing comment for issue %d\n", n)
-			_, _, err := client.Issues.EditComment(context.Background(), owner, repo, *i.Comments[idx].Comment.ID, &github.IssueComment{Body: &comment.Form.Body})
+			_, _, err := client.Issues.EditComment(context.Background(), owner, repo, *existing[idx].Comment.ID, &github.IssueComment{Body: &comment.Form.Body})
 			if err != nil {
-				return err
+				return existing, err
 			}
-			i.Comments[idx].Form.Body = comment.Form.Body
+			existing[idx].Form.Body = comment.Form.Body
 		}
 	}
 
-	return nil
+	return existing, nil
 }
 
 type IssuesListHandler struct {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+func TestSaveBlankComments(t *testing.T) {
+	doc := "# Issue\n\n## Comment\n\nBody = <<<EOF\nEOF\n\n## Comment\n\nBody = <<<EOF\n\nEOF\n\n## Comment\n\nBody = <<<EOF\n   \nEOF\n"
+	comments := splitComments(markform.Parse([]byte(doc)))
+	if len(comments) != 3 {
+		t.Fatalf("Expected 3 comments, got %d", len(comments))
+	}
+
+	// Only the template for a new comment is there, the others are extra
+	existing, err := saveComments("owner", "repo", 1, []Comment{{}}, comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != 1 {
+		t.Errorf("Expected no comments to be created, got %d", len(existing))
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	labelsMarkdown = template.Must(template.New("labels").Funcs(funcMap).Parse(
+		`# Labels
+
+Each row of the table is a label with its name, color and description. Add a row to create
+a label, change the color or description to update it and remove the row to delete it. A label
+is renamed by writing the new name in its Rename column. Colors are six hex digits, such as
+d73a4a, and a | or \ in a name or description is written as \| or \\.
+
+{{ markform .Form "Labels" }}
+
+To copy the labels of another repository fill in its owner/repo below. Labels that are missing
+are created and the colors and descriptions of labels with the same name are updated.
+
+* {{ markform .Form "CopyFrom" }}
+`))
+
+	labelColorPattern = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+	labelCellPattern  = regexp.MustCompile(`(?:\\.|[^|\\])*`)
+	labelEscape       = strings.NewReplacer(`\`, `\\`, "|", `\|`)
+	labelUnescape     = regexp.MustCompile(`\\([\\|])`)
+)
+
+// label is a row of the labels table
+type label struct {
+	Name        string
+	Color       string
+	Description string
+}
+
+// labelRow is a row of the labels table with the new name of the
+//  label when it's being renamed.
+type labelRow struct {
+	label
+	Rename string
+}
+
+// labelTable writes the labels as a markdown table with the columns
+//  lined up so that it's easy to read and edit.
+func labelTable(labels []label) string {
+	rows := [][]string{{"Name", "Color", "Description", "Rename"}}
+	for _, l := range labels {
+		rows = append(rows, []string{labelEscape.Replace(l.Name), l.Color, labelEscape.Replace(l.Description), ""})
+	}
+
+	widths := []int{3, 3, 3, 3}
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	lines := []string{}
+	for idx, row := range rows {
+		line := "|"
+		for i, cell := range row {
+			line = line + " " + cell + strings.Repeat(" ", widths[i]-len(cell)) + " |"
+		}
+		lines = append(lines, line)
+
+		if idx == 0 {
+			line = "|"
+			for _, width := range widths {
+				line = line + strings.Repeat("-", width+2) + "|"
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// parseLabelTable reads the rows of a labels table, skipping the
+//  header and the line under it. The Rename column can be left out.
+func parseLabelTable(table string) ([]labelRow, error) {
+	rows := []labelRow{}
+
+	for _, line := range strings.Split(table, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "|") {
+			return nil, fmt.Errorf("Rows of the labels table start with |, not %s", line)
+		}
+
+		cells := labelCellPattern.FindAllString(strings.TrimSuffix(line[1:], "|"), -1)
+		if len(cells) != 3 && len(cells) != 4 {
+			return nil, fmt.Errorf("Rows of the labels table have a name, color, description and rename: %s", line)
+		}
+		for i := range cells {
+			cells[i] = strings.TrimSpace(labelUnescape.ReplaceAllString(cells[i], "$1"))
+		}
+		if len(cells) == 3 {
+			cells = append(cells, "")
+		}
+
+		if strings.Trim(strings.Join(cells, ""), "-: ") == "" || (cells[0] == "Name" && cells[1] == "Color") {
+			continue
+		}
+
+		color := strings.ToLower(strings.TrimPrefix(cells[1], "#"))
+		if !labelColorPattern.MatchString(color) {
+			return nil, fmt.Errorf("The color of label %s should be six hex digits, not %s", cells[0], cells[1])
+		}
+
+		rows = append(rows, labelRow{label{cells[0], color, cells[2]}, cells[3]})
+	}
+
+	return rows, nil
+}
+
+// LabelsForm holds the labels table of a repository and another
+//  repository to copy the labels from.
+type LabelsForm struct {
+	Labels   string ` = <<<`
+	CopyFrom string ` = ___`
+}
+
+// LabelsHandler handles the labels.md of a repository with all of
+//  its labels.
+type LabelsHandler struct {
+	Form LabelsForm
+
+	labels   []label
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewLabelsHandler(repoPath string) {
+	handler := &LabelsHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(repoPath, "labels.md"), handler)
+	NewFormJSONHandler(path.Join(repoPath, "labels.json"), handler)
+}
+
+// listLabels lists all of the labels of a repository
+func listLabels(owner string, repo string) ([]label, error) {
+	labels := []label{}
+	options := &github.ListOptions{PerPage: 100}
+
+	for {
+		log.Printf("Listing labels for repo %s/%s\n", owner, repo)
+		ls, resp, err := uncachedClient.Issues.ListLabels(context.Background(), owner, repo, options)
+		if err != nil {
+			return labels, err
+		}
+
+		for _, l := range ls {
+			labels = append(labels, label{l.GetName(), l.GetColor(), l.GetDescription()})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	return labels, nil
+}
+
+func (lh *LabelsHandler) load(owner string, repo string) error {
+	labels, err := listLabels(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	lh.labels = labels
+	lh.Form = LabelsForm{Labels: labelTable(labels)}
+
+	return nil
+}
+
+func (lh *LabelsHandler) loadForm(name string) (interface{}, error) {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	err := lh.load(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	form := lh.Form
+	return &form, nil
+}
+
+func (lh *LabelsHandler) saveForm(name string, edited interface{}) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	return lh.save(owner, repo, edited.(*LabelsForm))
+}
+
+// save creates, renames, updates and deletes labels to match the
+//  table and then copies the labels of the other repository, if
+//  there is one.
+func (lh *LabelsHandler) save(owner string, repo string, form *LabelsForm) error {
+	rows, err := parseLabelTable(form.Labels)
+	if err != nil {
+		return err
+	}
+
+	before := make(map[string]label)
+	for _, l := range lh.labels {
+		before[l.Name] = l
+	}
+
+	kept := make(map[string]bool)
+	for _, r := range rows {
+		row := r.label
+		old := row.Name
+		if r.Rename != "" {
+			row.Name = r.Rename
+			if _, ok := before[old]; !ok {
+				return fmt.Errorf("Label %s can't be renamed since it doesn't exist", old)
+			}
+		}
+
+		if kept[old] {
+			return fmt.Errorf("Label %s is in the table more than once", old)
+		}
+		kept[old] = true
+
+		prev, ok := before[old]
+		if !ok {
+			log.Printf("Creating label %s in %s/%s\n", row.Name, owner, repo)
+			_, _, err := client.Issues.CreateLabel(context.Background(), owner, repo, &github.Label{Name: &row.Name, Color: &row.Color, Description: &row.Description})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if prev == row {
+			continue
+		}
+
+		log.Printf("Editing label %s in %s/%s\n", old, owner, repo)
+		_, _, err := client.Issues.EditLabel(context.Background(), owner, repo, url.PathEscape(old), &github.Label{Name: &row.Name, Color: &row.Color, Description: &row.Description})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, l := range lh.labels {
+		if kept[l.Name] {
+			continue
+		}
+
+		log.Printf("Deleting label %s from %s/%s\n", l.Name, owner, repo)
+		_, err := client.Issues.DeleteLabel(context.Background(), owner, repo, url.PathEscape(l.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	if form.CopyFrom != "" {
+		err = copyLabels(form.CopyFrom, owner, repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lh.load(owner, repo)
+}
+
+// copyLabels creates the labels of one repository in another one,
+//  updating the labels that are already there.
+func copyLabels(from string, owner string, repo string) error {
+	parts := strings.SplitN(from, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Labels are copied from a repository written as owner/repo, not %s", from)
+	}
+
+	source, err := listLabels(parts[0], parts[1])
+	if err != nil {
+		return err
+	}
+	existing, err := listLabels(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]label)
+	for _, l := range existing {
+		current[l.Name] = l
+	}
+
+	for _, l := range source {
+		l := l
+		prev, ok := current[l.Name]
+		if ok && prev == l {
+			continue
+		}
+
+		if ok {
+			log.Printf("Updating label %s in %s/%s from %s\n", l.Name, owner, repo, from)
+			_, _, err = client.Issues.EditLabel(context.Background(), owner, repo, url.PathEscape(l.Name), &github.Label{Color: &l.Color, Description: &l.Description})
+		} else {
+			log.Printf("Copying label %s to %s/%s from %s\n", l.Name, owner, repo, from)
+			_, _, err = client.Issues.CreateLabel(context.Background(), owner, repo, &github.Label{Name: &l.Name, Color: &l.Color, Description: &l.Description})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (lh *LabelsHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the labels.md file")
+}
+
+func (lh *LabelsHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	err := lh.load(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err = labelsMarkdown.Execute(&buf, lh)
+		if err != nil {
+			return err
+		}
+		lh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if lh.writefid != 0 {
+			return fmt.Errorf("Labels don't support concurrent writes")
+		}
+
+		lh.writefid = fid
+		lh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (lh *LabelsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	if offset >= int64(lh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(lh.readbuf.Len()) {
+		return lh.readbuf.Bytes()[offset:], nil
+	}
+
+	return lh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (lh *LabelsHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	if fid != lh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := lh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (lh *LabelsHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a labels.md is not supported")
+}
+
+func (lh *LabelsHandler) Stat(name string) (protocol.Dir, error) {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(lh.readbuf.Len())}, nil
+}
+
+func (lh *LabelsHandler) Wstat(name string, dir protocol.Dir) error {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	if lh.writebuf != nil {
+		lh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (lh *LabelsHandler) Remove(name string) error {
+	return fmt.Errorf("Removing labels.md isn't supported.")
+}
+
+func (lh *LabelsHandler) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+
+	if fid != lh.writefid {
+		return nil
+	}
+	lh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(lh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &LabelsForm{}
+	_, err := markform.Diff(&lh.Form, markform.Parse(lh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return lh.save(owner, repo, form)
+}
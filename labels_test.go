@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelTable(t *testing.T) {
+	labels := []label{
+		{"bug", "d73a4a", "Something isn't working"},
+		{"a|b", "0075ca", "Either a | or b"},
+		{"old -> new", "cfd3d7", "Not a rename"},
+		{`back\slash`, "a2eeef", `ends with \`},
+		{`pipe\|`, "7057ff", `\\|`},
+		{"---", "008672", ""},
+	}
+
+	rows, err := parseLabelTable(labelTable(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != len(labels) {
+		t.Fatalf("Expected %d labels, got %d:\n%s", len(labels), len(rows), labelTable(labels))
+	}
+	for i, row := range rows {
+		if row.label != labels[i] || row.Rename != "" {
+			t.Errorf("Expected label %v, got %v", labels[i], row)
+		}
+	}
+}
+
+func TestParseLabelTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    string
+		expected []labelRow
+		err      bool
+	}{
+		{
+			name: "rename",
+			table: `| Name | Color | Description | Rename |
+|------|-------|-------------|--------|
+| bug  | d73a4a | Broken     | defect |
+| wip  | #FBCA04 |           |        |`,
+			expected: []labelRow{
+				{label{"bug", "d73a4a", "Broken"}, "defect"},
+				{label{"wip", "fbca04", ""}, ""},
+			},
+		},
+		{
+			name: "no rename column",
+			table: `| Name | Color | Description |
+|------|-------|-------------|
+| a\|b | d73a4a | x \| y |`,
+			expected: []labelRow{
+				{label{"a|b", "d73a4a", "x | y"}, ""},
+			},
+		},
+		{
+			name: "unescaped pipe",
+			table: `| Name | Color | Description | Rename |
+| a|b | d73a4a | | |`,
+			err: true,
+		},
+		{
+			name:  "bad color",
+			table: `| bug | red | Broken | |`,
+			err:   true,
+		},
+		{
+			name:  "not a row",
+			table: `bug d73a4a`,
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		rows, err := parseLabelTable(test.table)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.name, rows)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(rows, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, rows)
+		}
+	}
+}
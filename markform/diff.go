@@ -0,0 +1,148 @@
+package markform
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// Change describes a single form field whose value in an edited
+//  document differs from the original struct. For list and checkbox
+//  group fields the elements that were added and removed are
+//  reported along with the complete old and new values.
+type Change struct {
+	Field   string
+	Old     interface{}
+	New     interface{}
+	Added   []string
+	Removed []string
+}
+
+// Changes is the set of changed fields reported by Diff in the
+//  order that the fields are declared in the struct.
+type Changes []Change
+
+// Has reports whether the named field was changed.
+func (c Changes) Has(fn string) bool {
+	_, ok := c.Get(fn)
+	return ok
+}
+
+// Get returns the change for the named field, if there is one.
+func (c Changes) Get(fn string) (Change, bool) {
+	for _, change := range c {
+		if change.Field == fn {
+			return change, true
+		}
+	}
+
+	return Change{}, false
+}
+
+// Fields returns the names of the changed fields.
+func (c Changes) Fields() []string {
+	fields := []string{}
+	for _, change := range c {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+// Diff unmarshals the edited document on top of a copy of the original
+//  struct and reports the form fields that have changed. The original
+//  struct is left untouched and the new values are stored in the struct
+//  pointed to by edited, which must have the same type as the original.
+//  Fields that are missing from the document keep their original value.
+func Diff(orig interface{}, tree *blackfriday.Node, edited interface{}) (Changes, error) {
+	ov := reflect.Indirect(reflect.ValueOf(orig))
+	ev := reflect.Indirect(reflect.ValueOf(edited))
+	ev.Set(ov)
+
+	err := Unmarshal(tree, edited)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compare(ov.Interface(), ev.Interface()), nil
+}
+
+// Compare reports the form fields that differ between two values
+//  of the same struct type.
+func Compare(orig interface{}, edited interface{}) Changes {
+	ov := reflect.Indirect(reflect.ValueOf(orig))
+	ev := reflect.Indirect(reflect.ValueOf(edited))
+	t := ov.Type()
+
+	changes := Changes{}
+
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if f.PkgPath != "" || !isFormField(string(f.Tag)) {
+			continue
+		}
+
+		oldValue := ov.Field(idx).Interface()
+		newValue := ev.Field(idx).Interface()
+
+		if f.Type.Kind() == reflect.Slice {
+			oldList, _ := oldValue.([]string)
+			newList, _ := newValue.([]string)
+			if equalLists(oldList, newList) {
+				continue
+			}
+			changes = append(changes, Change{Field: f.Name, Old: oldValue, New: newValue, Added: subtract(newList, oldList), Removed: subtract(oldList, newList)})
+			continue
+		}
+
+		if ot, ok := oldValue.(time.Time); ok && ot.Equal(newValue.(time.Time)) {
+			continue
+		} else if !ok && oldValue == newValue {
+			continue
+		}
+
+		changes = append(changes, Change{Field: f.Name, Old: oldValue, New: newValue})
+	}
+
+	return changes
+}
+
+func isFormField(tag string) bool {
+	return multilinePattern.MatchString(tag) ||
+		textPattern.MatchString(tag) ||
+		boolCheckBoxPattern.MatchString(tag) ||
+		radioPattern.MatchString(tag) ||
+		checkboxPattern.MatchString(tag) ||
+		listPattern.MatchString(tag) ||
+		timePattern.MatchString(tag)
+}
+
+func equalLists(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// subtract returns the elements of a that are not in b
+func subtract(a []string, b []string) []string {
+	result := []string{}
+	for _, av := range a {
+		found := false
+		for _, bv := range b {
+			if av == bv {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, av)
+		}
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package markform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+func TestDiff(t *testing.T) {
+	type Person struct {
+		Name         string    `* = ___[50]`
+		Gender       string    `* = () male () female`
+		Student      bool      `* = []`
+		Affiliations []string  ` = ,, ___`
+		Description  string    ` = ___`
+		Education    []string  ` = [] elementary [] secondary [] post-secondary`
+		DateOfBirth  time.Time ` = 2006-01-02T15:04:05Z`
+		Notes        string
+	}
+
+	dob, err := time.Parse(time.RFC3339, "2010-01-02T15:04:05Z")
+	if err != nil {
+		panic(err)
+	}
+
+	orig := Person{Name: "John Doe", Gender: "male", Student: true, Affiliations: []string{"Chess Club", "Band"}, Description: "Conscientious student", Education: []string{"elementary"}, DateOfBirth: dob, Notes: "not a form field"}
+
+	document :=
+		`# Name* = John Doe___[50]  - Personal Information
+
+Description = Conscientious student___
+
+* Gender* = (x) male () female
+* Student* = []
+* Affiliations = ,, Chess Club ,, Drama ,, ___
+* Education = [x] elementary [x] secondary [] post-secondary
+* DateOfBirth = 2010-01-02T15:04:05Z
+`
+
+	md := blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode))
+	tree := md.Parse([]byte(document))
+
+	edited := Person{}
+	changes, err := Diff(orig, tree, &edited)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(changes) != 3 {
+		t.Errorf("Unexpected changes: %v\n", changes.Fields())
+	}
+
+	if changes.Has("Name") || changes.Has("Gender") || changes.Has("Description") || changes.Has("DateOfBirth") || changes.Has("Notes") {
+		t.Errorf("Unchanged fields reported as changed: %v\n", changes.Fields())
+	}
+
+	c, ok := changes.Get("Student")
+	if !ok {
+		t.Errorf("Student change not found\n")
+	} else if c.Old != true || c.New != false {
+		t.Errorf("Unexpected student change: %v -> %v\n", c.Old, c.New)
+	}
+
+	c, ok = changes.Get("Affiliations")
+	if !ok {
+		t.Errorf("Affiliations change not found\n")
+	} else {
+		if len(c.Added) != 1 || c.Added[0] != "Drama" {
+			t.Errorf("Unexpected added affiliations: %v\n", c.Added)
+		}
+		if len(c.Removed) != 1 || c.Removed[0] != "Band" {
+			t.Errorf("Unexpected removed affiliations: %v\n", c.Removed)
+		}
+	}
+
+	c, ok = changes.Get("Education")
+	if !ok {
+		t.Errorf("Education change not found\n")
+	} else if len(c.Added) != 1 || c.Added[0] != "secondary" || len(c.Removed) != 0 {
+		t.Errorf("Unexpected education change: %v %v\n", c.Added, c.Removed)
+	}
+
+	if edited.Notes != "not a form field" || edited.Student {
+		t.Errorf("Edited struct not filled in: %v\n", edited)
+	}
+
+	if len(orig.Affiliations) != 2 || !orig.Student {
+		t.Errorf("Original struct was modified: %v\n", orig)
+	}
+}
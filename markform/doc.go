@@ -16,6 +16,7 @@ your structs for the purpose of marshaling and unmarshaling values of the struct
                 Affiliations   []string ` = ,, ___`              // list of any values from the user
                 Description    string   ` = ___`                 // Unbounded, maybe  multi-line string
                 Education      []string ` = [] elementary [] secondary [] post-secondary`
+                Biography      string   ` = <<<`                 // multi-line text kept exactly as written
         }
 
 Note that the struct field tags provide the template of the suffix for each of the form elements.
@@ -43,5 +44,50 @@ in a readable way and even add inline text that helps to guide the user.
 
         `))
 
+Multi-line text fields are written as a block between a line that ends with "<<<" and a delimiter,
+and a line containing only that delimiter. Marshal picks a delimiter that doesn't appear in the value.
+
+        Biography = <<<EOF
+        Anything at all, including *markdown*, code blocks and horizontal rules.
+        EOF
+
+Documents need to be parsed with Parse, instead of using blackfriday directly, so that the contents
+of these blocks are preserved exactly when they are unmarshaled.
+
+        tree := markform.Parse(document)
+        err := markform.Unmarshal(tree, &person)
+
+The choices of radio and checkbox group fields don't have to be fixed in the struct field tags.
+If the struct implements OptionsProvider then the options it returns for a field are shown
+instead, and unmarshaling rejects any choice that isn't one of those options.
+
+        type Assignment struct {
+                Milestone  string   ` = () ...`
+                milestones []string
+        }
+
+        func (a Assignment) Options(fn string) []string {
+                if fn == "Milestone" {
+                        return a.milestones
+                }
+                return nil
+        }
+
+Structs that are filled in some other way, such as from JSON, can be checked with Validate, which
+rejects the same choices of radio and checkbox group fields that unmarshaling does.
+
+        err := markform.Validate(&assignment)
+
+When a modified document is saved you can find out which fields were changed compared to the
+original struct using Diff. Each change includes the old and new values of the field and, for list
+and checkbox group fields, the elements that were added and removed. This makes it possible to
+build a single update from all of the changes.
+
+        edited := Person{}
+        changes, err := markform.Diff(original, tree, &edited)
+        if changes.Has("Name") {
+                ...
+        }
+
 */
 package markform
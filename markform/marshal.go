@@ -10,6 +10,7 @@ import (
 )
 
 var (
+	multilinePattern    = regexp.MustCompile(`(\*??) = <<<$`)
 	textPattern         = regexp.MustCompilePOSIX(`(\*?) = ___((\[([0-9]+)\])?)`)
 	boolCheckBoxPattern = regexp.MustCompile(`(\*??) = \[\]$`)
 	radioPattern        = regexp.MustCompile(`(\*??) = ((\(\) .*)+)`)
@@ -18,6 +19,24 @@ var (
 	timePattern         = regexp.MustCompile(`(\*??) = 2006-01-02T15:04:05Z`)
 )
 
+// OptionsProvider is implemented by structs that supply the choices
+//  of their radio and checkbox group fields at runtime instead of in
+//  the struct field tag. The options returned for a field replace the
+//  ones from the tag when marshaling and the unmarshaled values are
+//  validated against them. Fields with runtime options are usually
+//  tagged with a placeholder such as " = () ..." or " = [] ...".
+//  A nil result means that the tag's options are used.
+type OptionsProvider interface {
+	Options(fn string) []string
+}
+
+func runtimeOptions(v interface{}, fn string) []string {
+	if provider, ok := v.(OptionsProvider); ok {
+		return provider.Options(fn)
+	}
+	return nil
+}
+
 // Marshal a specified field from a struct
 //  in markform.
 func Marshal(v interface{}, fn string) string {
@@ -31,7 +50,12 @@ func Marshal(v interface{}, fn string) string {
 
 	tag := string(f.Tag)
 
-	if textPattern.MatchString(tag) {
+	if multilinePattern.MatchString(tag) {
+		value := reflect.ValueOf(v).FieldByName(fn).String()
+		components := multilinePattern.FindStringSubmatch(tag)
+		delim := multilineDelimiter(value)
+		return fmt.Sprintf("%s%s = <<<%s\n%s\n%s", fn, components[1], delim, value, delim)
+	} else if textPattern.MatchString(tag) {
 		value := reflect.ValueOf(v).FieldByName(fn).String()
 		components := textPattern.FindStringSubmatch(tag)
 		if components[2] != "" {
@@ -53,9 +77,41 @@ func Marshal(v interface{}, fn string) string {
 		return fmt.Sprintf("%s%s = %s", fn, components[1], checkbox)
 	} else if radioPattern.MatchString(tag) {
 		value := reflect.ValueOf(v).FieldByName(fn).String()
+		if options := runtimeOptions(v, fn); options != nil {
+			components := radioPattern.FindStringSubmatch(tag)
+			tag = components[1] + " ="
+			for _, option := range options {
+				if option == value {
+					tag = tag + " (x) " + option
+				} else {
+					tag = tag + " () " + option
+				}
+			}
+			return fn + tag
+		}
 		tag = strings.Replace(tag, "() "+value, "(x) "+value, 1)
 		return fn + tag
 	} else if checkboxPattern.MatchString(tag) {
+		if options := runtimeOptions(v, fn); options != nil {
+			components := checkboxPattern.FindStringSubmatch(tag)
+			tag = components[1] + " ="
+			values := reflect.ValueOf(v).FieldByName(fn)
+			for _, option := range options {
+				checked := false
+				for idx := 0; idx < values.Len(); idx++ {
+					if values.Index(idx).String() == option {
+						checked = true
+						break
+					}
+				}
+				if checked {
+					tag = tag + " [x] " + option
+				} else {
+					tag = tag + " [] " + option
+				}
+			}
+			return fn + tag
+		}
 		length := reflect.ValueOf(v).FieldByName(fn).Len()
 		for idx := 0; idx < length; idx++ {
 			value := reflect.ValueOf(v).FieldByName(fn).Index(idx).String()
@@ -200,3 +200,56 @@ Save this file to record any changes to the person record.
 		t.Errorf("Unexpected value: %s\n", buf.Bytes())
 	}
 }
+
+type optionsStruct struct {
+	Milestone string   ` = () ...`
+	Labels    []string `* = [] ...`
+	Color     string   ` = () red () green`
+}
+
+func (o optionsStruct) Options(fn string) []string {
+	switch fn {
+	case "Milestone":
+		return []string{"v1.0", "v1.1 beta"}
+	case "Labels":
+		return []string{"bug", "good first issue", "enhancement"}
+	}
+	return nil
+}
+
+func TestMarshal_RuntimeOptions(t *testing.T) {
+	v := optionsStruct{Milestone: "v1.1 beta", Labels: []string{"bug", "enhancement"}, Color: "green"}
+	m := Marshal(v, "Milestone")
+	if "Milestone = () v1.0 (x) v1.1 beta" != m {
+		t.Errorf("Unexpected value %s\n", m)
+	}
+
+	m = Marshal(v, "Labels")
+	if "Labels* = [x] bug [] good first issue [x] enhancement" != m {
+		t.Errorf("Unexpected value %s\n", m)
+	}
+
+	m = Marshal(v, "Color")
+	if "Color = () red (x) green" != m {
+		t.Errorf("Unexpected value %s\n", m)
+	}
+}
+
+func TestMarshal_MultilineText(t *testing.T) {
+	type astruct struct {
+		Body string ` = <<<`
+		Note string `* = <<<`
+	}
+
+	v := astruct{Body: "line1\nline2"}
+	m := Marshal(v, "Body")
+	if "Body = <<<EOF\nline1\nline2\nEOF" != m {
+		t.Errorf("Unexpected value %s\n", m)
+	}
+
+	v = astruct{Note: "EOF\nEOF1\n"}
+	m = Marshal(v, "Note")
+	if "Note* = <<<EOF2\nEOF\nEOF1\n\nEOF2" != m {
+		t.Errorf("Unexpected value %s\n", m)
+	}
+}
@@ -0,0 +1,91 @@
+package markform
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+var (
+	multilineStartPattern = regexp.MustCompile(`(\w+)(\*?) = <<<(\w+)\s*$`)
+	multilineValuePattern = regexp.MustCompile(`^multiline:([0-9a-f]*)`)
+)
+
+// Parse a markform document into a markdown tree that can be passed
+//  to Unmarshal or Diff. Multi-line text blocks are collapsed before
+//  the markdown is parsed so that their contents are kept exactly as
+//  they were written, even if they contain markdown of their own.
+//  Underscores inside of words, such as pull_request, aren't
+//  treated as emphasis.
+func Parse(doc []byte) *blackfriday.Node {
+	lines := strings.Split(string(doc), "\n")
+	result := []string{}
+
+	for idx := 0; idx < len(lines); idx++ {
+		line := lines[idx]
+		g := multilineStartPattern.FindStringSubmatchIndex(line)
+		if g == nil {
+			result = append(result, line)
+			continue
+		}
+
+		delim := line[g[6]:g[7]]
+		end := -1
+		for j := idx + 1; j < len(lines); j++ {
+			if strings.TrimRight(lines[j], " \t\r") == delim {
+				end = j
+				break
+			}
+		}
+
+		// Unterminated blocks are left for Unmarshal to report
+		if end == -1 {
+			result = append(result, line)
+			continue
+		}
+
+		content := strings.Join(lines[idx+1:end], "\n")
+		result = append(result, fmt.Sprintf("%smultiline:%s", line[:g[6]-3], hex.EncodeToString([]byte(content))))
+		idx = end
+	}
+
+	md := blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode | blackfriday.NoIntraEmphasis))
+	return md.Parse([]byte(strings.Join(result, "\n")))
+}
+
+// multilineDelimiter picks a delimiter for a multi-line text block
+//  that doesn't appear on a line of its own in the value.
+func multilineDelimiter(value string) string {
+	lines := strings.Split(value, "\n")
+	delim := "EOF"
+	for n := 1; ; n++ {
+		found := false
+		for _, line := range lines {
+			if strings.TrimRight(line, " \t\r") == delim {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return delim
+		}
+		delim = fmt.Sprintf("EOF%d", n)
+	}
+}
+
+func decodeMultiline(fn string, value string) (string, error) {
+	g := multilineValuePattern.FindStringSubmatch(value)
+	if g == nil {
+		return "", fmt.Errorf("Unterminated multi-line text for %s", fn)
+	}
+
+	content, err := hex.DecodeString(g[1])
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
@@ -0,0 +1,42 @@
+package markform
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// TypeOf returns the Go type of the struct field that
+//  holds the value for a markform struct field tag.
+func TypeOf(tag string) (reflect.Type, bool) {
+	if multilinePattern.MatchString(tag) || textPattern.MatchString(tag) {
+		return reflect.TypeOf(""), true
+	} else if boolCheckBoxPattern.MatchString(tag) {
+		return reflect.TypeOf(false), true
+	} else if radioPattern.MatchString(tag) {
+		return reflect.TypeOf(""), true
+	} else if checkboxPattern.MatchString(tag) || listPattern.MatchString(tag) {
+		return reflect.TypeOf([]string{}), true
+	} else if timePattern.MatchString(tag) {
+		return reflect.TypeOf(time.Time{}), true
+	}
+
+	return nil, false
+}
+
+// Fields returns the names of the form fields that appear
+//  in a document in the order that they appear.
+func Fields(tree *blackfriday.Node) []string {
+	names := []string{}
+	tree.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type == blackfriday.Text {
+			groups := formVarPattern.FindStringSubmatch(string(node.Literal))
+			if groups != nil {
+				names = append(names, groups[1])
+			}
+		}
+		return blackfriday.GoToNext
+	})
+	return names
+}
@@ -0,0 +1,39 @@
+package markform
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTypeOf(t *testing.T) {
+	tags := map[string]reflect.Type{
+		`* = ___[50]`:             reflect.TypeOf(""),
+		` = <<<`:                  reflect.TypeOf(""),
+		` = []`:                   reflect.TypeOf(false),
+		`* = () male () female`:   reflect.TypeOf(""),
+		` = [] red [] blue`:       reflect.TypeOf([]string{}),
+		` = ,, ___`:               reflect.TypeOf([]string{}),
+		` = 2006-01-02T15:04:05Z`: reflect.TypeOf(time.Time{}),
+	}
+
+	for tag, expected := range tags {
+		ft, ok := TypeOf(tag)
+		if !ok || ft != expected {
+			t.Errorf("Unexpected type for %q: %v\n", tag, ft)
+		}
+	}
+
+	if _, ok := TypeOf(`json:"name"`); ok {
+		t.Errorf("Expected unknown tag to have no type\n")
+	}
+}
+
+func TestFields(t *testing.T) {
+	document := "# Name* = John Doe___[50]\n\n* Gender* = (x) male () female\n* Student* = [x]\n\nBio = <<<EOF\nNotes = ___\nEOF\n"
+
+	fields := Fields(Parse([]byte(document)))
+	if !reflect.DeepEqual(fields, []string{"Name", "Gender", "Student", "Bio"}) {
+		t.Errorf("Unexpected fields: %v\n", fields)
+	}
+}
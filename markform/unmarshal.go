@@ -1,6 +1,7 @@
 package markform
 
 import (
+	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -11,11 +12,92 @@ import (
 )
 
 var (
-	formVarPattern = regexp.MustCompile(`(?s)(\w+)(\*??) =(.*)`)
+	formVarPattern   = regexp.MustCompile(`(?s)(\w+)(\*??) =(.*)`)
+	radioMarkPattern = regexp.MustCompile(`\((x?)\) `)
+	checkMarkPattern = regexp.MustCompile(`\[(x?)\] `)
 )
 
+// selections returns the labels of the choices that are marked
+//  with an x in a radio or checkbox group value.
+func selections(value string, mark *regexp.Regexp) []string {
+	selected := []string{}
+	marks := mark.FindAllStringSubmatchIndex(value, -1)
+	for idx, m := range marks {
+		if m[3] == m[2] {
+			continue
+		}
+		end := len(value)
+		if idx+1 < len(marks) {
+			end = marks[idx+1][0]
+		}
+		selected = append(selected, strings.TrimSpace(value[m[1]:end]))
+	}
+	return selected
+}
+
+func validOption(options []string, value string) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// tagOptions returns the options of a radio or checkbox group that
+//  are listed in its struct field tag.
+func tagOptions(tag string, pattern *regexp.Regexp, sep string) []string {
+	options := []string{}
+	for _, option := range strings.Split(pattern.FindStringSubmatch(tag)[2], sep) {
+		option = strings.TrimRight(option, " ")
+		if option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// Validate checks that the radio and checkbox group fields of a
+//  struct only have the options from their tags, or from the struct
+//  if it is an OptionsProvider. Unmarshal rejects the choices of a
+//  document that aren't options in the same way, so this is for
+//  structs that were filled in some other way, such as from JSON.
+//  A radio group that is empty has nothing selected.
+func Validate(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	t := rv.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := string(f.Tag)
+
+		if radioPattern.MatchString(tag) && f.Type.Kind() == reflect.String {
+			options := runtimeOptions(v, f.Name)
+			if options == nil {
+				options = tagOptions(tag, radioPattern, "() ")
+			}
+			if value := rv.Field(i).String(); value != "" && !validOption(options, value) {
+				return fmt.Errorf("%s is not a valid option for %s", value, f.Name)
+			}
+		} else if checkboxPattern.MatchString(tag) && f.Type == reflect.TypeOf([]string{}) {
+			options := runtimeOptions(v, f.Name)
+			if options == nil {
+				options = tagOptions(tag, checkboxPattern, "[] ")
+			}
+			for _, value := range rv.Field(i).Interface().([]string) {
+				if !validOption(options, value) {
+					return fmt.Errorf("%s is not a valid option for %s", value, f.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func Unmarshal(tree *blackfriday.Node, v interface{}) error {
 	t := reflect.Indirect(reflect.ValueOf(v)).Type()
+	var err error
 	tree.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
 		if node.Type == blackfriday.Text {
 			groups := formVarPattern.FindStringSubmatch(string(node.Literal))
@@ -33,6 +115,13 @@ func Unmarshal(tree *blackfriday.Node, v interface{}) error {
 						} else if strings.HasPrefix(value, "[]") {
 							fv.SetBool(false)
 						}
+					} else if multilinePattern.MatchString(string(f.Tag)) {
+						content, e := decodeMultiline(fn, value)
+						if e != nil {
+							err = e
+							return blackfriday.Terminate
+						}
+						fv.SetString(content)
 					} else if textPattern.MatchString(string(f.Tag)) {
 						endOfText := strings.Index(value, "___")
 						if endOfText != -1 {
@@ -55,37 +144,63 @@ func Unmarshal(tree *blackfriday.Node, v interface{}) error {
 						}
 						value = strings.TrimSpace(value)
 						fv.SetString(value)
+					} else if options := runtimeOptions(v, fn); options != nil && radioPattern.MatchString(string(f.Tag)) {
+						selected := selections(value, radioMarkPattern)
+						if len(selected) > 1 {
+							err = fmt.Errorf("Only one option can be selected for %s", fn)
+							return blackfriday.Terminate
+						}
+						if len(selected) == 1 {
+							if !validOption(options, selected[0]) {
+								err = fmt.Errorf("%s is not a valid option for %s", selected[0], fn)
+								return blackfriday.Terminate
+							}
+							fv.SetString(selected[0])
+						}
+					} else if options != nil && checkboxPattern.MatchString(string(f.Tag)) {
+						fv.Set(reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf("")), 0, 0))
+						for _, option := range selections(value, checkMarkPattern) {
+							if !validOption(options, option) {
+								err = fmt.Errorf("%s is not a valid option for %s", option, fn)
+								return blackfriday.Terminate
+							}
+							fv.Set(reflect.Append(fv, reflect.ValueOf(option)))
+						}
 					} else if radioPattern.MatchString(string(f.Tag)) {
-						g := radioPattern.FindStringSubmatch(string(f.Tag))
-						options := strings.Split(g[2], "() ")
-						for _, option := range options {
-							option = strings.TrimRight(option, " ")
-							if option != "" && strings.Contains(value, "(x) "+option) {
-								fv.SetString(option)
-								break
+						// The whole label is compared so that an option
+						//  that starts with another one isn't mistaken for it
+						selected := selections(value, radioMarkPattern)
+						if len(selected) > 1 {
+							err = fmt.Errorf("Only one option can be selected for %s", fn)
+							return blackfriday.Terminate
+						}
+						if len(selected) == 1 {
+							if !validOption(tagOptions(string(f.Tag), radioPattern, "() "), selected[0]) {
+								err = fmt.Errorf("%s is not a valid option for %s", selected[0], fn)
+								return blackfriday.Terminate
 							}
+							fv.SetString(selected[0])
 						}
 					} else if checkboxPattern.MatchString(string(f.Tag)) {
-						g := checkboxPattern.FindStringSubmatch(string(f.Tag))
-						options := strings.Split(g[2], "[] ")
+						options := tagOptions(string(f.Tag), checkboxPattern, "[] ")
 						fv.Set(reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf("")), 0, 0))
-						for _, option := range options {
-							option = strings.TrimRight(option, " ")
-							if option != "" && strings.Contains(value, "[x] "+option) {
-								fv.Set(reflect.Append(fv, reflect.ValueOf(option)))
+						for _, option := range selections(value, checkMarkPattern) {
+							if !validOption(options, option) {
+								err = fmt.Errorf("%s is not a valid option for %s", option, fn)
+								return blackfriday.Terminate
 							}
+							fv.Set(reflect.Append(fv, reflect.ValueOf(option)))
 						}
 					} else if listPattern.MatchString(string(f.Tag)) {
 						fv.Set(reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf("")), 0, 0))
 						listitems := strings.Split(value, ",, ")
 						for _, listitem := range listitems {
+							// The space before the next ,, may be missing
+							listitem = strings.TrimSpace(listitem)
 							if listitem == "" || listitem == "___" {
 								continue
 							}
 
-							// Trim the trailing space
-							listitem = listitem[:len(listitem)-1]
-
 							fv.Set(reflect.Append(fv, reflect.ValueOf(listitem)))
 						}
 					} else if timePattern.MatchString(string(f.Tag)) {
@@ -100,5 +215,5 @@ func Unmarshal(tree *blackfriday.Node, v interface{}) error {
 		}
 		return blackfriday.GoToNext
 	})
-	return nil
+	return err
 }
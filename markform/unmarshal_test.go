@@ -119,3 +119,245 @@ Save this file to record any changes to the person record.
 		t.Errorf("Unexpected description: %s\n", person.Description)
 	}
 }
+
+func TestUnmarshalRuntimeOptions(t *testing.T) {
+	document := `* Milestone = () v1.0 (x) v1.1 beta
+* Labels* = [x] bug [x] good first issue [] enhancement
+* Color = (x) red () green
+`
+
+	v := optionsStruct{}
+	md := blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode))
+	err := Unmarshal(md.Parse([]byte(document)), &v)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if v.Milestone != "v1.1 beta" {
+		t.Errorf("Unexpected milestone: %s\n", v.Milestone)
+	}
+
+	if len(v.Labels) != 2 || v.Labels[0] != "bug" || v.Labels[1] != "good first issue" {
+		t.Errorf("Unexpected labels: %v\n", v.Labels)
+	}
+
+	if v.Color != "red" {
+		t.Errorf("Unexpected color: %s\n", v.Color)
+	}
+
+	document = `* Labels* = [x] bug [x] wontfix [] enhancement
+`
+	v = optionsStruct{}
+	md = blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode))
+	err = Unmarshal(md.Parse([]byte(document)), &v)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown option\n")
+	}
+
+	document = `* Milestone = (x) v1.0 (x) v1.1 beta
+`
+	v = optionsStruct{}
+	md = blackfriday.New(blackfriday.WithExtensions(blackfriday.FencedCode))
+	err = Unmarshal(md.Parse([]byte(document)), &v)
+	if err == nil {
+		t.Errorf("Expected an error for multiple radio selections\n")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value optionsStruct
+		err   bool
+	}{
+		{"empty", optionsStruct{}, false},
+		{"valid", optionsStruct{Milestone: "v1.1 beta", Labels: []string{"bug", "enhancement"}, Color: "green"}, false},
+		{"unknown runtime radio option", optionsStruct{Milestone: "v2.0"}, true},
+		{"unknown runtime checkbox option", optionsStruct{Labels: []string{"bug", "wontfix"}}, true},
+		{"unknown tag radio option", optionsStruct{Color: "blue"}, true},
+	}
+
+	for _, test := range tests {
+		err := Validate(&test.value)
+		if test.err && err == nil {
+			t.Errorf("%s: expected an error\n", test.name)
+		} else if !test.err && err != nil {
+			t.Errorf("%s: %v\n", test.name, err)
+		}
+	}
+
+	type tagged struct {
+		Education []string ` = [] elementary [] secondary [] post-secondary`
+		Notes     string
+	}
+	if err := Validate(&tagged{Education: []string{"post-secondary"}}); err != nil {
+		t.Errorf("Unexpected error for a valid tag checkbox option: %v\n", err)
+	}
+	if err := Validate(&tagged{Education: []string{"university"}}); err == nil {
+		t.Errorf("Expected an error for an unknown tag checkbox option\n")
+	}
+
+	// Unmarshal rejects the same choices
+	err := Unmarshal(Parse([]byte("* Education = [] elementary [x] university\n")), &tagged{})
+	if err == nil {
+		t.Errorf("Expected an error for unmarshaling an unknown tag checkbox option\n")
+	}
+	err = Unmarshal(Parse([]byte("* Color = () red (x) blue\n")), &optionsStruct{})
+	if err == nil {
+		t.Errorf("Expected an error for unmarshaling an unknown tag radio option\n")
+	}
+}
+
+func TestUnmarshalRadioPrefix(t *testing.T) {
+	type Run struct {
+		Action string ` = () none () rerun () rerun-failed () cancel`
+	}
+
+	tests := []struct {
+		document string
+		expected string
+		err      bool
+	}{
+		{"* Action = () none () rerun (x) rerun-failed () cancel\n", "rerun-failed", false},
+		{"* Action = () none (x) rerun () rerun-failed () cancel\n", "rerun", false},
+		{"* Action = () none () rerun () rerun-failed () cancel\n", "", false},
+		{"* Action = () none (x) rerun (x) rerun-failed () cancel\n", "", true},
+		{"* Action = () none () rerun () rerun-failed (x) delete\n", "", true},
+	}
+
+	for _, test := range tests {
+		run := Run{}
+		err := Unmarshal(Parse([]byte(test.document)), &run)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected an error for %q\n", test.document)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v\n", test.document, err)
+		}
+
+		if run.Action != test.expected {
+			t.Errorf("Expected %q for %q, got %q\n", test.expected, test.document, run.Action)
+		}
+	}
+}
+
+func TestUnmarshalCheckboxPrefix(t *testing.T) {
+	type Hook struct {
+		Events []string ` = [] push [] pull [] pull-request`
+	}
+
+	hook := Hook{}
+	err := Unmarshal(Parse([]byte("* Events = [] push [] pull [x] pull-request\n")), &hook)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(hook.Events) != 1 || hook.Events[0] != "pull-request" {
+		t.Errorf("Unexpected events: %v\n", hook.Events)
+	}
+
+	err = Unmarshal(Parse([]byte("* Events = [] push [x] fetch [] pull-request\n")), &hook)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown option\n")
+	}
+}
+
+func TestUnmarshalList(t *testing.T) {
+	type Access struct {
+		Read []string ` = ,, ___`
+	}
+
+	tests := []string{
+		"* Read = ,, alice ,, bob ,, ___\n",
+		"* Read = ,, alice ,, bob,, ___\n",
+		"* Read = ,, alice ,, bob\n",
+		"* Read = ,, alice,, bob ,,  ___\n",
+	}
+
+	for _, document := range tests {
+		access := Access{}
+		err := Unmarshal(Parse([]byte(document)), &access)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if len(access.Read) != 2 || access.Read[0] != "alice" || access.Read[1] != "bob" {
+			t.Errorf("Unexpected list %q for %q\n", access.Read, document)
+		}
+	}
+}
+
+func TestUnmarshalMultilineText(t *testing.T) {
+	type Post struct {
+		Title string ` = ___`
+		Body  string ` = <<<`
+		Notes string ` = <<<`
+	}
+
+	body := "Some *markdown* text\n\n```go\nfmt.Println(\"hi\")\n```\n\n---\n\n# A heading\n\n    indented\nEOF2\n"
+	orig := Post{Title: "Post", Body: body}
+
+	document := "# " + Marshal(orig, "Title") + "\n\n" + Marshal(orig, "Body") + "\n\n" + Marshal(orig, "Notes") + "\n\nThe end\n"
+
+	post := Post{}
+	err := Unmarshal(Parse([]byte(document)), &post)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if post.Title != "Post" {
+		t.Errorf("Unexpected title: %s\n", post.Title)
+	}
+
+	if post.Body != body {
+		t.Errorf("Unexpected body: %q\n", post.Body)
+	}
+
+	if post.Notes != "" {
+		t.Errorf("Unexpected notes: %q\n", post.Notes)
+	}
+
+	document = "Body = <<<END\nsome text\n"
+	err = Unmarshal(Parse([]byte(document)), &post)
+	if err == nil {
+		t.Errorf("Expected an error for unterminated text\n")
+	}
+}
+
+func TestUnmarshalUnderscores(t *testing.T) {
+	type Hook struct {
+		Branch string   ` = ___`
+		Events []string ` = [] push [] pull_request [] pull_request_review`
+	}
+
+	document := "* Branch = my_feature_branch\n* Events = [] push [x] pull_request [x] pull_request_review\n"
+
+	hook := Hook{}
+	err := Unmarshal(Parse([]byte(document)), &hook)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if hook.Branch != "my_feature_branch" {
+		t.Errorf("Unexpected branch: %s\n", hook.Branch)
+	}
+
+	if len(hook.Events) != 2 || hook.Events[0] != "pull_request" || hook.Events[1] != "pull_request_review" {
+		t.Errorf("Unexpected events: %v\n", hook.Events)
+	}
+
+	document = "* Events = [] push [] pull_request [x] pull_request_review\n"
+
+	hook = Hook{}
+	err = Unmarshal(Parse([]byte(document)), &hook)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(hook.Events) != 1 || hook.Events[0] != "pull_request_review" {
+		t.Errorf("Unexpected events: %v\n", hook.Events)
+	}
+}
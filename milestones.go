@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	milestoneMarkdown = template.Must(template.New("milestone").Funcs(funcMap).Parse(
+		`{{ if .Milestone }}# Milestone {{ .Milestone.GetNumber }}
+{{ else }}# New milestone
+
+Fill in the milestone and save this file to create it. It then shows up as N.md.
+{{ end }}
+* {{ markform .Form "Title" }}
+* {{ markform .Form "State" }}
+* {{ markform .Form "DueOn" }}
+{{- if .Milestone }}
+* Open issues: {{ .Milestone.GetOpenIssues }}
+* Closed issues: {{ .Milestone.GetClosedIssues }}
+* Progress: {{ .Progress }}{{ end }}
+
+{{ markform .Form "Description" }}
+{{ if .Milestone }}
+## Issues
+
+{{ range .Issues }}  * [{{ .GetNumber }}](../{{ if .IsPullRequest }}pulls{{ else }}issues{{ end }}/{{ .GetNumber }}.md) {{ .GetState }} - {{ .GetTitle }}
+{{ else }}There are no issues in this milestone.
+{{ end }}{{ end }}`))
+)
+
+// progressBar draws how much of a milestone is done in text
+func progressBar(closed int, total int) string {
+	const width = 20
+
+	if total == 0 {
+		return "[" + strings.Repeat("-", width) + "] 0%"
+	}
+
+	done := closed * width / total
+	return fmt.Sprintf("[%s%s] %d%%", strings.Repeat("#", done), strings.Repeat("-", width-done), closed*100/total)
+}
+
+// MilestonesHandler handles the milestones directory of a repository,
+//  which has a markform file for each milestone. New milestones are
+//  created by creating new files in the directory.
+type MilestonesHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewMilestonesHandler(repoPath string) {
+	handler := &MilestonesHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(path.Join(repoPath, "milestones"), handler)
+}
+
+func (mh *MilestonesHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := mh.BasicDirHandler.WalkChild(name, child)
+
+	if n, e := issueNumber(child); idx == -1 && e == nil {
+		owner := path.Base(path.Dir(path.Dir(name)))
+		repo := path.Base(path.Dir(name))
+
+		log.Printf("Checking if milestone %d exists\n", n)
+		_, _, err = client.Issues.GetMilestone(context.Background(), owner, repo, n)
+		if err != nil {
+			return -1, err
+		}
+
+		mh.add(path.Join(name, strconv.Itoa(n)))
+		return mh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+// add adds the files of an existing milestone to the directory
+func (mh *MilestonesHandler) add(milestonePath string) {
+	NewMilestoneHandler(milestonePath)
+
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if mh.filter != nil {
+		mh.filter[milestonePath+".md"] = true
+		mh.filter[milestonePath+".json"] = true
+	}
+}
+
+func (mh *MilestonesHandler) refresh(name string) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	filter := make(map[string]bool)
+	options := &github.MilestoneListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		log.Printf("Listing milestones of %s/%s\n", owner, repo)
+		milestones, resp, err := uncachedClient.Issues.ListMilestones(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+
+		for _, milestone := range milestones {
+			milestonePath := path.Join(name, strconv.Itoa(milestone.GetNumber()))
+			NewMilestoneHandler(milestonePath)
+			filter[milestonePath+".md"] = true
+			filter[milestonePath+".json"] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	mh.mu.Lock()
+	previous := mh.filter
+	mh.mu.Unlock()
+
+	// Keep the new milestones that haven't been saved yet
+	for fn := range previous {
+		if filter[fn] {
+			continue
+		}
+
+		var milestone *MilestoneHandler
+		server.MatchFile(func(f *dynamic.FileEntry) bool {
+			if f.Name != fn {
+				return false
+			}
+			milestone, _ = f.Handler.(*MilestoneHandler)
+			return true
+		})
+		if milestone != nil && milestone.isNew() {
+			filter[fn] = true
+		}
+	}
+
+	mh.mu.Lock()
+	mh.filter = filter
+	mh.mu.Unlock()
+
+	return nil
+}
+
+func (mh *MilestonesHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := mh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return mh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (mh *MilestonesHandler) CreateChild(name string, child string) (int, error) {
+	if _, err := issueNumber(child); err == nil || path.Ext(child) != ".md" {
+		return -1, fmt.Errorf("New milestones are created with a file such as new.md")
+	}
+
+	childPath := path.Join(name, child)
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return idx, nil
+	}
+
+	handler := &MilestoneHandler{mh: mh, created: true, readbuf: &bytes.Buffer{}}
+	handler.Form.Title = strings.TrimSuffix(child, path.Ext(child))
+	handler.Form.State = "open"
+	err := milestoneMarkdown.Execute(handler.readbuf, handler)
+	if err != nil {
+		return -1, err
+	}
+	idx = server.AddFileEntry(childPath, handler)
+
+	mh.mu.Lock()
+	if mh.filter != nil {
+		mh.filter[childPath] = true
+	}
+	mh.mu.Unlock()
+
+	return idx, nil
+}
+
+// MilestoneForm holds the editable fields of a milestone
+type MilestoneForm struct {
+	Title       string    ` = ___`
+	State       string    ` = () open () closed`
+	DueOn       time.Time ` = 2006-01-02T15:04:05Z`
+	Description string    ` = <<<`
+}
+
+// MilestoneHandler handles the markform file of a milestone showing
+//  its progress and the issues in it. Milestones that are created
+//  aren't numbered yet so they are saved to create the milestone and
+//  then removed.
+type MilestoneHandler struct {
+	Milestone *github.Milestone
+	Issues    []*github.Issue
+	Form      MilestoneForm
+
+	mh       *MilestonesHandler
+	created  bool
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewMilestoneHandler(milestonePath string) {
+	handler := &MilestoneHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(milestonePath+".md", handler)
+	NewFormJSONHandler(milestonePath+".json", handler)
+}
+
+// isNew reports whether the milestone still needs to be created
+func (mh *MilestoneHandler) isNew() bool {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	return mh.created
+}
+
+// Progress is a text progress bar of the closed issues of the milestone
+func (mh *MilestoneHandler) Progress() string {
+	closed := mh.Milestone.GetClosedIssues()
+	return progressBar(closed, closed+mh.Milestone.GetOpenIssues())
+}
+
+func (mh *MilestoneHandler) load(owner string, repo string, n int) error {
+	log.Printf("Reading milestone %d of %s/%s\n", n, owner, repo)
+	milestone, _, err := uncachedClient.Issues.GetMilestone(context.Background(), owner, repo, n)
+	if err != nil {
+		return err
+	}
+
+	issues := []*github.Issue{}
+	options := &github.IssueListByRepoOptions{Milestone: strconv.Itoa(n), State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		log.Printf("Listing the issues of milestone %d of %s/%s\n", n, owner, repo)
+		is, resp, err := uncachedClient.Issues.ListByRepo(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+		issues = append(issues, is...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	mh.Milestone = milestone
+	mh.Issues = issues
+	mh.Form.Title = milestone.GetTitle()
+	mh.Form.State = milestone.GetState()
+	mh.Form.DueOn = milestone.GetDueOn()
+	mh.Form.Description = milestone.GetDescription()
+
+	return nil
+}
+
+func (mh *MilestoneHandler) loadForm(name string) (interface{}, error) {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if !mh.created {
+		n, err := issueNumber(name)
+		if err != nil {
+			return nil, err
+		}
+
+		err = mh.load(owner, repo, n)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	form := mh.Form
+	return &form, nil
+}
+
+func (mh *MilestoneHandler) saveForm(name string, edited interface{}) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	form := edited.(*MilestoneForm)
+	return mh.save(owner, repo, name, markform.Compare(&mh.Form, form), form)
+}
+
+// save creates the milestone if it is new, otherwise the changes of
+//  the edited form are applied to the milestone.
+func (mh *MilestoneHandler) save(owner string, repo string, name string, changes markform.Changes, form *MilestoneForm) error {
+	edit := &github.Milestone{}
+	if mh.created || changes.Has("Title") {
+		if strings.TrimSpace(form.Title) == "" {
+			return fmt.Errorf("The Title of the milestone is required")
+		}
+		edit.Title = &form.Title
+	}
+	if mh.created || changes.Has("State") {
+		edit.State = &form.State
+	}
+	if changes.Has("DueOn") && !form.DueOn.IsZero() {
+		edit.DueOn = &form.DueOn
+	}
+	if changes.Has("Description") {
+		edit.Description = &form.Description
+	}
+
+	if mh.created {
+		log.Printf("Creating milestone %s in %s/%s\n", form.Title, owner, repo)
+		milestone, _, err := client.Issues.CreateMilestone(context.Background(), owner, repo, edit)
+		if err != nil {
+			return err
+		}
+
+		mh.mh.add(path.Join(path.Dir(name), strconv.Itoa(milestone.GetNumber())))
+		server.RemoveFileEntry(name)
+		return nil
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	n, err := issueNumber(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Editing milestone %d of %s/%s\n", n, owner, repo)
+	_, _, err = client.Issues.EditMilestone(context.Background(), owner, repo, n, edit)
+	if err != nil {
+		return err
+	}
+
+	mh.Form = *form
+
+	return nil
+}
+
+func (mh *MilestoneHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of a milestone")
+}
+
+func (mh *MilestoneHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if !mh.created {
+		n, err := issueNumber(name)
+		if err != nil {
+			return err
+		}
+
+		err = mh.load(owner, repo, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err := milestoneMarkdown.Execute(&buf, mh)
+		if err != nil {
+			return err
+		}
+		mh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if mh.writefid != 0 {
+			return fmt.Errorf("Milestone doesn't support concurrent writes")
+		}
+
+		mh.writefid = fid
+		mh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (mh *MilestoneHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if offset >= int64(mh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(mh.readbuf.Len()) {
+		return mh.readbuf.Bytes()[offset:], nil
+	}
+
+	return mh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (mh *MilestoneHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if fid != mh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := mh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (mh *MilestoneHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a milestone is not supported")
+}
+
+func (mh *MilestoneHandler) Stat(name string) (protocol.Dir, error) {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(mh.readbuf.Len())}, nil
+}
+
+func (mh *MilestoneHandler) Wstat(name string, dir protocol.Dir) error {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if mh.writebuf != nil {
+		mh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (mh *MilestoneHandler) Remove(name string) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	// A milestone that was never created only needs to be forgotten
+	if mh.created {
+		return nil
+	}
+
+	n, err := issueNumber(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Deleting milestone %d of %s/%s\n", n, owner, repo)
+	_, err = client.Issues.DeleteMilestone(context.Background(), owner, repo, n)
+	if err != nil {
+		return err
+	}
+
+	server.RemoveFileEntry(strings.TrimSuffix(name, path.Ext(name)) + ".json")
+	return nil
+}
+
+func (mh *MilestoneHandler) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	if fid != mh.writefid {
+		return nil
+	}
+	mh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(mh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &MilestoneForm{}
+	changes, err := markform.Diff(&mh.Form, markform.Parse(mh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return mh.save(owner, repo, name, changes, form)
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+)
+
+var (
+	patchesMarkdown = template.Must(template.New("patches").Funcs(funcMap).Parse(
+		`# Patches
+
+Replace the contents of this file with a unified diff or the mbox from git format-patch to
+apply it to a new branch off the default branch. Each patch in the mbox becomes a commit with the author and
+message of the patch. A plain diff uses the text before it as the message and the author from commit.md.
+
+These headers can be put at the top, before the diff or with the headers of the first patch:
+
+    Branch: the name of the new branch, otherwise it's named after the commit
+    Pull-Request: yes to open a pull request from the branch, or draft for a draft
+
+## Result
+
+{{ if .Result }}{{ markdown .Result }}{{ else }}No patches have been applied yet.{{ end }}
+`))
+
+	mboxPattern      = regexp.MustCompile(`^From [0-9a-f]{40} `)
+	headerPattern    = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*):\s*(.*)$`)
+	subjectPattern   = regexp.MustCompile(`^\[PATCH[^\]]*\]\s*`)
+	hunkPattern      = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+	indexModePattern = regexp.MustCompile(`^index [0-9a-f]+\.\.[0-9a-f]+ (\d+)$`)
+
+	// patchHeaders are the headers that are read from the top of a
+	//  plain diff, other lines there are part of the message.
+	patchHeaders = map[string]bool{"from": true, "date": true, "subject": true, "branch": true, "pull-request": true}
+)
+
+// hunk is a hunk of a unified diff. The lines keep their
+//  leading space, minus or plus.
+type hunk struct {
+	header   string
+	oldStart int
+	oldCount int
+	newStart int
+	newCount int
+	lines    []string
+}
+
+// filePatch is the diff of a single file. The old path is empty
+//  when the file is created and the new path is empty when it is
+//  deleted. The paths of a plain diff without the a/ and b/ prefixes
+//  are often backup files, like diff -u f.orig f, so the new path is
+//  changed and the old one is only read when it exists.
+type filePatch struct {
+	oldPath string
+	newPath string
+	plain   bool
+	mode    string
+	binary  bool
+	hunks   []*hunk
+}
+
+// patch is a single commit worth of changes from a diff or mbox
+type patch struct {
+	headers map[string]string
+	subject string
+	message string
+	author  *github.CommitAuthor
+	files   []*filePatch
+}
+
+// splitPatches splits an mbox into its patches. A plain diff is a
+//  single patch.
+func splitPatches(content string) []string {
+	patches := []string{}
+	current := []string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		if mboxPattern.MatchString(line) && len(current) != 0 {
+			patches = append(patches, strings.Join(current, "\n"))
+			current = []string{}
+		}
+		current = append(current, line)
+	}
+
+	if strings.TrimSpace(strings.Join(current, "\n")) != "" {
+		patches = append(patches, strings.Join(current, "\n"))
+	}
+
+	return patches
+}
+
+// patchPath is the path of a file in the --- or +++ line of a diff
+func patchPath(value string, prefix string) string {
+	// Plain diffs can have a timestamp after the path
+	value = strings.SplitN(value, "\t", 2)[0]
+	if value == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(value, prefix)
+}
+
+// parsePatch parses the headers, message and diff of a patch
+func parsePatch(content string) (*patch, error) {
+	p := &patch{headers: make(map[string]string)}
+	lines := strings.Split(content, "\n")
+	i := 0
+
+	mbox := false
+	if i < len(lines) && mboxPattern.MatchString(lines[i]) {
+		mbox = true
+		i++
+	}
+
+	// Headers, which may be folded onto more than one line. A plain
+	//  diff only has the known ones so that a message like "docs: fix
+	//  typo" isn't taken for a header.
+	last := ""
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			i++
+			break
+		}
+
+		if m := headerPattern.FindStringSubmatch(line); m != nil && (mbox || patchHeaders[strings.ToLower(m[1])]) {
+			last = strings.ToLower(m[1])
+			p.headers[last] = m[2]
+		} else if last != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			p.headers[last] += " " + strings.TrimSpace(line)
+		} else {
+			break
+		}
+	}
+
+	// The message goes until the diff starts
+	message := []string{}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "---" || strings.HasPrefix(line, "diff ") || (strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")) {
+			break
+		}
+		message = append(message, line)
+	}
+
+	p.subject = strings.TrimSpace(subjectPattern.ReplaceAllString(p.headers["subject"], ""))
+	p.message = strings.TrimSpace(strings.Join(message, "\n"))
+	if p.subject != "" {
+		p.message = strings.TrimSpace(p.subject + "\n\n" + p.message)
+	}
+	if p.subject == "" {
+		p.subject = summary(p.message)
+	}
+
+	if from, ok := p.headers["from"]; ok {
+		address, err := mail.ParseAddress(from)
+		if err != nil {
+			return nil, fmt.Errorf("The From header %q isn't an email address: %v", from, err)
+		}
+		p.author = &github.CommitAuthor{Name: &address.Name, Email: &address.Address}
+
+		if date, ok := p.headers["date"]; ok {
+			t, err := mail.ParseDate(date)
+			if err != nil {
+				return nil, fmt.Errorf("The Date header %q isn't a valid date: %v", date, err)
+			}
+			p.author.Date = &t
+		}
+	}
+
+	// The diff of each file
+	var file *filePatch
+	git := false
+	for i < len(lines) {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			git = true
+			file = &filePatch{}
+			p.files = append(p.files, file)
+			names := strings.SplitN(strings.TrimPrefix(line, "diff --git "), " b/", 2)
+			if len(names) == 2 {
+				file.oldPath = strings.TrimPrefix(names[0], "a/")
+				file.newPath = names[1]
+			}
+		case file != nil && strings.HasPrefix(line, "new file mode "):
+			file.oldPath = ""
+			file.mode = strings.TrimPrefix(line, "new file mode ")
+		case file != nil && strings.HasPrefix(line, "deleted file mode "):
+			file.newPath = ""
+		case file != nil && strings.HasPrefix(line, "new mode "):
+			file.mode = strings.TrimPrefix(line, "new mode ")
+		case file != nil && strings.HasPrefix(line, "rename from "):
+			file.oldPath = strings.TrimPrefix(line, "rename from ")
+		case file != nil && strings.HasPrefix(line, "rename to "):
+			file.newPath = strings.TrimPrefix(line, "rename to ")
+		case file != nil && indexModePattern.MatchString(line):
+			file.mode = indexModePattern.FindStringSubmatch(line)[1]
+		case file != nil && (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch"):
+			file.binary = true
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath := strings.TrimPrefix(line, "--- ")
+			newPath := strings.TrimPrefix(lines[i+1], "+++ ")
+			i++
+
+			// A plain diff has no diff line before each file
+			if !git || file == nil || len(file.hunks) != 0 {
+				file = &filePatch{}
+				p.files = append(p.files, file)
+				oldPrefix, newPrefix := "", ""
+				if strings.HasPrefix(oldPath, "a/") && strings.HasPrefix(newPath, "b/") {
+					oldPrefix, newPrefix = "a/", "b/"
+				} else {
+					file.plain = true
+				}
+				file.oldPath = patchPath(oldPath, oldPrefix)
+				file.newPath = patchPath(newPath, newPrefix)
+			}
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkPattern.FindStringSubmatch(line)
+			if m == nil || file == nil {
+				return nil, fmt.Errorf("The hunk %q isn't part of a file in the diff", line)
+			}
+
+			h := &hunk{header: line}
+			h.oldStart, _ = strconv.Atoi(m[1])
+			h.oldCount = 1
+			if m[2] != "" {
+				h.oldCount, _ = strconv.Atoi(m[2])
+			}
+			h.newStart, _ = strconv.Atoi(m[3])
+			h.newCount = 1
+			if m[4] != "" {
+				h.newCount, _ = strconv.Atoi(m[4])
+			}
+
+			oldLines, newLines := 0, 0
+			for i+1 < len(lines) && (oldLines < h.oldCount || newLines < h.newCount || strings.HasPrefix(lines[i+1], "\\")) {
+				i++
+				l := lines[i]
+				switch {
+				case strings.HasPrefix(l, "\\"):
+				case strings.HasPrefix(l, "-"):
+					oldLines++
+				case strings.HasPrefix(l, "+"):
+					newLines++
+				case strings.HasPrefix(l, " ") || l == "":
+					// Some editors strip the space from blank context lines
+					l = " " + strings.TrimPrefix(l, " ")
+					oldLines++
+					newLines++
+				default:
+					return nil, fmt.Errorf("The hunk %q of %s has an unexpected line %q", line, file.newPath, l)
+				}
+				h.lines = append(h.lines, l)
+			}
+			if oldLines != h.oldCount || newLines != h.newCount {
+				return nil, fmt.Errorf("The hunk %q of %s is cut short", line, file.newPath)
+			}
+
+			file.hunks = append(file.hunks, h)
+		case line == "-- ":
+			// The signature at the end of git format-patch
+			i = len(lines)
+		}
+
+		i++
+	}
+
+	if len(p.files) == 0 {
+		return nil, fmt.Errorf("There is no diff in the patch")
+	}
+
+	return p, nil
+}
+
+// applyHunks applies the hunks of a file to its content. A hunk can
+//  be applied a little before or after where it says as long as its
+//  context lines match.
+func applyHunks(content string, file *filePatch) (string, error) {
+	lines := strings.Split(content, "\n")
+	eol := strings.HasSuffix(content, "\n") || content == ""
+	if eol {
+		lines = lines[:len(lines)-1]
+	}
+
+	drift := 0
+	for _, h := range file.hunks {
+		old := []string{}
+		new := []string{}
+		oldEOL, newEOL := true, true
+		previous := byte(0)
+		for _, l := range h.lines {
+			switch l[0] {
+			case '\\':
+				// No newline at the end of the file
+				oldEOL = oldEOL && previous == '+'
+				newEOL = newEOL && previous == '-'
+			case '-':
+				old = append(old, l[1:])
+			case '+':
+				new = append(new, l[1:])
+			default:
+				old = append(old, l[1:])
+				new = append(new, l[1:])
+			}
+			previous = l[0]
+		}
+		if !newEOL {
+			eol = false
+		} else if !oldEOL {
+			eol = true
+		}
+
+		expected := h.newStart - 1 + drift
+		if h.newCount == 0 {
+			expected = h.newStart + drift
+		}
+
+		pos := -1
+		for distance := 0; pos == -1 && distance <= len(lines); distance++ {
+			for _, p := range []int{expected - distance, expected + distance} {
+				if p >= 0 && p+len(old) <= len(lines) && equalLines(lines[p:p+len(old)], old) {
+					pos = p
+					break
+				}
+			}
+		}
+		if pos == -1 {
+			return "", fmt.Errorf("Hunk %s of %s doesn't apply:\n\n%s", h.header, file.oldPath, strings.Join(h.lines, "\n"))
+		}
+
+		drift = pos - expected + drift
+		lines = append(lines[:pos], append(new, lines[pos+len(old):]...)...)
+	}
+
+	result := strings.Join(lines, "\n")
+	if eol && len(lines) != 0 {
+		result += "\n"
+	}
+	return result, nil
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// patchTree tracks the files of the branch that the patches are
+//  applied to. Files that were changed by earlier patches are kept
+//  so that later patches see the changes.
+type patchTree struct {
+	owner   string
+	repo    string
+	entries map[string]github.TreeEntry
+	changed map[string]*string
+}
+
+// read reads the content of a file as it is after the patches so far
+func (pt *patchTree) read(p string) (string, bool, error) {
+	if content, ok := pt.changed[p]; ok {
+		if content == nil {
+			return "", false, nil
+		}
+		return *content, true, nil
+	}
+
+	entry, ok := pt.entries[p]
+	if !ok || entry.GetType() != "blob" {
+		return "", false, nil
+	}
+
+	log.Printf("Reading blob %s of %s/%s\n", p, pt.owner, pt.repo)
+	content, _, err := client.Git.GetBlobRaw(context.Background(), pt.owner, pt.repo, entry.GetSHA())
+	if err != nil {
+		return "", false, err
+	}
+	return string(content), true, nil
+}
+
+// apply applies the diff of a patch and returns the entries of the
+//  tree that it changes.
+func (pt *patchTree) apply(p *patch) ([]map[string]interface{}, error) {
+	entries := []map[string]interface{}{}
+
+	for _, file := range p.files {
+		name := file.newPath
+		if name == "" {
+			name = file.oldPath
+		}
+		if file.binary {
+			return nil, fmt.Errorf("The binary diff of %s can't be applied", name)
+		}
+
+		oldPath := file.oldPath
+		if file.plain && oldPath != "" && file.newPath != "" {
+			if _, ok, err := pt.read(oldPath); err != nil {
+				return nil, err
+			} else if !ok {
+				oldPath = file.newPath
+			}
+		}
+
+		content := ""
+		if oldPath != "" {
+			c, ok, err := pt.read(oldPath)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s doesn't exist on the branch", oldPath)
+			}
+			content = c
+		} else if _, ok, _ := pt.read(file.newPath); ok {
+			return nil, fmt.Errorf("%s already exists on the branch", file.newPath)
+		}
+
+		content, err := applyHunks(content, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := file.mode
+		if mode == "" {
+			mode = "100644"
+			if entry, ok := pt.entries[oldPath]; ok {
+				mode = entry.GetMode()
+			}
+		}
+
+		// A plain diff of two different files changes the new one
+		//  and leaves the old one alone.
+		if oldPath != "" && oldPath != file.newPath && (file.newPath == "" || !file.plain) {
+			pt.changed[oldPath] = nil
+			entries = append(entries, map[string]interface{}{"path": oldPath, "mode": mode, "type": "blob", "sha": nil})
+		}
+		if file.newPath != "" {
+			pt.changed[file.newPath] = &content
+			entries = append(entries, map[string]interface{}{"path": file.newPath, "mode": mode, "type": "blob", "content": content})
+		}
+	}
+
+	return entries, nil
+}
+
+// applyPatches applies the patches to a new branch off the default
+//  branch, opening a pull request if asked to. It returns a summary
+//  of what was done.
+func applyPatches(owner string, repo string, content string) (string, error) {
+	patches := []*patch{}
+	for _, text := range splitPatches(content) {
+		p, err := parsePatch(text)
+		if err != nil {
+			return "", err
+		}
+		patches = append(patches, p)
+	}
+	if len(patches) == 0 {
+		return "", fmt.Errorf("There are no patches to apply")
+	}
+	headers := patches[0].headers
+
+	log.Printf("Reading repo %s/%s\n", owner, repo)
+	r, _, err := client.Repositories.Get(context.Background(), owner, repo)
+	if err != nil {
+		return "", err
+	}
+	base := r.GetDefaultBranch()
+
+	log.Printf("Reading ref heads/%s of %s/%s\n", base, owner, repo)
+	ref, _, err := uncachedClient.Git.GetRef(context.Background(), owner, repo, "heads/"+base)
+	if err != nil {
+		return "", err
+	}
+	parent := ref.GetObject().GetSHA()
+
+	log.Printf("Reading commit %s of %s/%s\n", parent, owner, repo)
+	commit, _, err := client.Git.GetCommit(context.Background(), owner, repo, parent)
+	if err != nil {
+		return "", err
+	}
+	treeSHA := commit.GetTree().GetSHA()
+
+	log.Printf("Reading tree %s of %s/%s\n", treeSHA, owner, repo)
+	tree, _, err := client.Git.GetTree(context.Background(), owner, repo, treeSHA, true)
+	if err != nil {
+		return "", err
+	}
+	if tree.GetTruncated() {
+		return "", fmt.Errorf("The tree of %s is too large to apply patches to", base)
+	}
+
+	pt := &patchTree{owner: owner, repo: repo, entries: make(map[string]github.TreeEntry), changed: make(map[string]*string)}
+	for _, entry := range tree.Entries {
+		pt.entries[entry.GetPath()] = entry
+	}
+
+	for _, p := range patches {
+		entries, err := pt.apply(p)
+		if err != nil {
+			return "", err
+		}
+
+		body := struct {
+			BaseTree string                   `json:"base_tree"`
+			Tree     []map[string]interface{} `json:"tree"`
+		}{treeSHA, entries}
+		req, err := client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/git/trees", owner, repo), body)
+		if err != nil {
+			return "", err
+		}
+
+		log.Printf("Creating a tree for %q in %s/%s\n", p.subject, owner, repo)
+		newTree := &github.Tree{}
+		_, err = client.Do(context.Background(), req, newTree)
+		if err != nil {
+			return "", err
+		}
+		treeSHA = newTree.GetSHA()
+
+		message, author := &p.message, p.author
+		if author == nil {
+			message, author = nextCommit(owner, repo, "Apply patch")
+			if p.message != "" {
+				message = &p.message
+			}
+		}
+
+		log.Printf("Creating a commit for %q in %s/%s\n", p.subject, owner, repo)
+		c, _, err := client.Git.CreateCommit(context.Background(), owner, repo, &github.Commit{
+			Message: message,
+			Author:  author,
+			Tree:    &github.Tree{SHA: &treeSHA},
+			Parents: []github.Commit{{SHA: &parent}},
+		})
+		if err != nil {
+			return "", err
+		}
+		commitMade(owner, repo, *message)
+		parent = c.GetSHA()
+	}
+
+	branch := strings.TrimSpace(headers["branch"])
+	if branch == "" {
+		branch = "patch-" + parent[:7]
+	}
+
+	log.Printf("Creating branch %s at %s in %s/%s\n", branch, parent, owner, repo)
+	branchRef := "refs/heads/" + branch
+	_, _, err = client.Git.CreateRef(context.Background(), owner, repo, &github.Reference{Ref: &branchRef, Object: &github.GitObject{SHA: &parent}})
+	if err != nil {
+		return "", err
+	}
+
+	result := fmt.Sprintf("Applied %d patches to branch %s off %s, which is now at commit %s.\n", len(patches), branch, base, parent)
+
+	pull := strings.ToLower(strings.TrimSpace(headers["pull-request"]))
+	if pull == "yes" || pull == "draft" {
+		form := &NewPullForm{Title: patches[0].subject, Head: branch, Base: base, Draft: pull == "draft"}
+		if len(patches) == 1 {
+			form.Body = strings.TrimSpace(strings.TrimPrefix(patches[0].message, patches[0].subject))
+		} else {
+			for _, p := range patches {
+				form.Body += "* " + p.subject + "\n"
+			}
+		}
+
+		pr, err := createPull(owner, repo, form)
+		if err != nil {
+			return result, err
+		}
+		result += fmt.Sprintf("Opened pull request %d, see pulls/%d.md.\n", pr.GetNumber(), pr.GetNumber())
+	}
+
+	return result, nil
+}
+
+// NewPatchesHandler adds the patches directory of a repository with
+//  the inbox that patches are written to.
+func NewPatchesHandler(repoPath string) {
+	patchesPath := path.Join(repoPath, "patches")
+	server.AddFileEntry(patchesPath, &dynamic.BasicDirHandler{server, nil})
+	server.AddFileEntry(path.Join(patchesPath, "new"), &PatchInbox{readbuf: &bytes.Buffer{}})
+}
+
+// PatchInbox handles the patches/new file. Writing a patch to it
+//  applies the patch and the result is shown when it's read again.
+type PatchInbox struct {
+	Result string
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func (pi *PatchInbox) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the patch inbox")
+}
+
+func (pi *PatchInbox) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if mode == protocol.OREAD {
+		buf := bytes.Buffer{}
+		err := patchesMarkdown.Execute(&buf, pi)
+		if err != nil {
+			return err
+		}
+		pi.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if pi.writefid != 0 {
+			return fmt.Errorf("The patch inbox doesn't support concurrent writes")
+		}
+
+		pi.writefid = fid
+		pi.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (pi *PatchInbox) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if offset >= int64(pi.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(pi.readbuf.Len()) {
+		return pi.readbuf.Bytes()[offset:], nil
+	}
+
+	return pi.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (pi *PatchInbox) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if fid != pi.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := pi.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (pi *PatchInbox) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of the patch inbox is not supported")
+}
+
+func (pi *PatchInbox) Stat(name string) (protocol.Dir, error) {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(pi.readbuf.Len())}, nil
+}
+
+func (pi *PatchInbox) Wstat(name string, dir protocol.Dir) error {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if pi.writebuf != nil {
+		pi.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (pi *PatchInbox) Remove(name string) error {
+	return fmt.Errorf("Removing the patch inbox isn't supported.")
+}
+
+func (pi *PatchInbox) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	if fid != pi.writefid {
+		return nil
+	}
+	pi.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(pi.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	result, err := applyPatches(owner, repo, pi.writebuf.String())
+	if err != nil {
+		pi.Result = result + "The patch couldn't be applied: " + err.Error()
+		return err
+	}
+	pi.Result = result
+
+	return nil
+}
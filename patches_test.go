@@ -0,0 +1,365 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const mboxSeries = `From 1111111111111111111111111111111111111111 Mon Sep 17 00:00:00 2001
+From: Jane Doe <jane@example.com>
+Date: Mon, 1 Jan 2018 10:00:00 +0000
+Subject: [PATCH 1/2] Add the
+ greeting
+Branch: greetings
+
+Say hello to everyone.
+---
+ hello.txt | 1 +
+ 1 file changed, 1 insertion(+)
+
+diff --git a/hello.txt b/hello.txt
+new file mode 100644
+index 0000000..ce01362
+--- /dev/null
++++ b/hello.txt
+@@ -0,0 +1 @@
++hello
+--
+2.17.1
+
+From 2222222222222222222222222222222222222222 Mon Sep 17 00:00:00 2001
+From: John Doe <john@example.com>
+Date: Mon, 1 Jan 2018 11:00:00 +0000
+Subject: [PATCH 2/2] Remove the old notes
+
+---
+diff --git a/notes.txt b/notes.txt
+deleted file mode 100644
+index 3b18e51..0000000
+--- a/notes.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-some
+-notes
+--
+2.17.1
+`
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		patches  int
+		subject  string
+		message  string
+		author   string
+		branch   string
+		oldPaths []string
+		newPaths []string
+		plain    bool
+		err      bool
+	}{
+		{
+			name:     "mbox series",
+			content:  mboxSeries,
+			patches:  2,
+			subject:  "Add the greeting",
+			message:  "Add the greeting\n\nSay hello to everyone.",
+			author:   "jane@example.com",
+			branch:   "greetings",
+			oldPaths: []string{""},
+			newPaths: []string{"hello.txt"},
+		},
+		{
+			name: "plain diff with a message",
+			content: `docs: fix typo
+Branch: not-a-header
+
+--- a/README.md
++++ b/README.md
+@@ -1 +1 @@
+-teh
++the
+`,
+			patches:  1,
+			subject:  "docs: fix typo",
+			message:  "docs: fix typo\nBranch: not-a-header",
+			oldPaths: []string{"README.md"},
+			newPaths: []string{"README.md"},
+		},
+		{
+			name: "plain diff with headers",
+			content: `Branch: typos
+Pull-Request: draft
+
+docs: fix typo
+
+--- f.orig	2018-01-01 10:00:00.000000000 +0000
++++ f	2018-01-01 10:01:00.000000000 +0000
+@@ -1 +1 @@
+-teh
++the
+`,
+			patches:  1,
+			subject:  "docs: fix typo",
+			message:  "docs: fix typo",
+			branch:   "typos",
+			oldPaths: []string{"f.orig"},
+			newPaths: []string{"f"},
+			plain:    true,
+		},
+		{
+			name: "new and deleted files",
+			content: `diff --git a/new.txt b/new.txt
+new file mode 100755
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++#!/bin/sh
++echo new
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+`,
+			patches:  1,
+			oldPaths: []string{"", "old.txt"},
+			newPaths: []string{"new.txt", ""},
+		},
+		{
+			name: "hunk cut short",
+			content: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ one
+-two
+`,
+			patches: 1,
+			err:     true,
+		},
+		{
+			name:    "no diff",
+			content: "Just a message\n",
+			patches: 1,
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		texts := splitPatches(test.content)
+		if len(texts) != test.patches {
+			t.Errorf("%s: expected %d patches, got %d", test.name, test.patches, len(texts))
+			continue
+		}
+
+		p, err := parsePatch(texts[0])
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if p.subject != test.subject {
+			t.Errorf("%s: unexpected subject %q", test.name, p.subject)
+		}
+		if p.message != test.message {
+			t.Errorf("%s: unexpected message %q", test.name, p.message)
+		}
+		if p.headers["branch"] != test.branch {
+			t.Errorf("%s: unexpected branch %q", test.name, p.headers["branch"])
+		}
+		if test.author == "" && p.author != nil {
+			t.Errorf("%s: unexpected author %v", test.name, p.author)
+		}
+		if test.author != "" && (p.author == nil || p.author.GetEmail() != test.author) {
+			t.Errorf("%s: unexpected author %v", test.name, p.author)
+		}
+
+		if len(p.files) != len(test.newPaths) {
+			t.Errorf("%s: expected %d files, got %d", test.name, len(test.newPaths), len(p.files))
+			continue
+		}
+		for i, file := range p.files {
+			if file.oldPath != test.oldPaths[i] || file.newPath != test.newPaths[i] {
+				t.Errorf("%s: unexpected paths %q and %q of file %d", test.name, file.oldPath, file.newPath, i)
+			}
+			if file.plain != test.plain {
+				t.Errorf("%s: unexpected plain %v of file %d", test.name, file.plain, i)
+			}
+		}
+	}
+}
+
+func TestParsePatchSeries(t *testing.T) {
+	texts := splitPatches(mboxSeries)
+	if len(texts) != 2 {
+		t.Fatalf("Expected 2 patches, got %d", len(texts))
+	}
+
+	p, err := parsePatch(texts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.subject != "Remove the old notes" || p.author.GetEmail() != "john@example.com" {
+		t.Errorf("Unexpected subject %q or author %v", p.subject, p.author)
+	}
+	if p.author.GetDate().Hour() != 11 {
+		t.Errorf("Unexpected date %v", p.author.GetDate())
+	}
+	if len(p.files) != 1 || p.files[0].oldPath != "notes.txt" || p.files[0].newPath != "" {
+		t.Errorf("Unexpected files %v", p.files)
+	}
+	if p.files[0].mode != "" {
+		t.Errorf("Unexpected mode %q", p.files[0].mode)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		diff     string
+		expected string
+		err      bool
+	}{
+		{
+			name:    "exact",
+			content: "one\ntwo\nthree\n",
+			diff: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+`,
+			expected: "one\n2\nthree\n",
+		},
+		{
+			name:    "offset drift",
+			content: "zero\nhalf\none\ntwo\nthree\nfour\nfive\nsix\n",
+			diff: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+@@ -5,2 +5,3 @@
+ five
++five and a half
+ six
+`,
+			expected: "zero\nhalf\none\n2\nthree\nfour\nfive\nfive and a half\nsix\n",
+		},
+		{
+			name:    "add a newline at the end",
+			content: "one\ntwo",
+			diff: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ one
+-two
+\ No newline at end of file
++two
+`,
+			expected: "one\ntwo\n",
+		},
+		{
+			name:    "remove the newline at the end",
+			content: "one\ntwo\n",
+			diff: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ one
+-two
++two
+\ No newline at end of file
+`,
+			expected: "one\ntwo",
+		},
+		{
+			name:    "new file",
+			content: "",
+			diff: `--- /dev/null
++++ b/f
+@@ -0,0 +1,2 @@
++one
++two
+`,
+			expected: "one\ntwo\n",
+		},
+		{
+			name:    "deleted file",
+			content: "one\ntwo\n",
+			diff: `--- a/f
++++ /dev/null
+@@ -1,2 +0,0 @@
+-one
+-two
+`,
+			expected: "",
+		},
+		{
+			name:    "context doesn't match",
+			content: "one\ntwo\nthree\n",
+			diff: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ one
+-deux
++2
+ three
+`,
+			err: true,
+		},
+		{
+			name:    "second hunk doesn't apply",
+			content: "one\ntwo\nthree\n",
+			diff: `--- a/f
++++ b/f
+@@ -1 +1 @@
+-one
++1
+@@ -3 +3 @@
+-four
++4
+`,
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		p, err := parsePatch(test.diff)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		result, err := applyHunks(test.content, p.files[0])
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %q", test.name, result)
+			} else if !strings.Contains(err.Error(), "doesn't apply") {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if result != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, result)
+		}
+	}
+}
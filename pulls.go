@@ -0,0 +1,1123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	pullMarkdown = template.Must(template.New("pull").Funcs(funcMap).Parse(
+		`# {{ markform .Form "Title" }}
+
+* {{ markform .Form "State" }}
+* OpenedBy: [{{ .Pull.User.GetLogin }}](../../../{{ .Pull.User.GetLogin }})
+* CreatedAt: {{ .Pull.GetCreatedAt.Format "2006-01-02T15:04:05Z07:00" }}
+* Head: {{ .Pull.Head.GetLabel }} {{ .Pull.Head.GetSHA }}
+* Checks: {{ .Checks.State }}{{ checks .Checks }}
+* {{ markform .Form "Base" }}
+* {{ markform .Form "Draft" }}
+* Merged: {{ .Pull.GetMerged }} Mergeable: {{ .Pull.GetMergeableState }}
+* Changes: {{ .Pull.GetCommits }} commits, {{ .Pull.GetChangedFiles }} files, +{{ .Pull.GetAdditions }} -{{ .Pull.GetDeletions }}
+* {{ markform .Form "Labels" }}
+* {{ markform .Form "Reviewers" }}
+
+{{ markform .Form "Body" }}
+
+Choose how to merge the pull request and save to merge it.
+
+* {{ markform .Form "Merge" }}
+
+
+`))
+
+	pullsListMarkdown = template.Must(template.New("pullsList").Funcs(funcMap).Parse(
+		`# Pull Requests
+
+This is a list of pull requests for the project. You can change the filter by editing filter.md, save it and Get this list again. You can create a new pull request by editing new.md .
+
+{{ range . }}  * {{ .GetNumber }}.md [{{ .GetState }}] - {{ .GetTitle }} - {{ .Head.GetLabel }} into {{ .Base.GetRef }} - [ {{ range .Labels }}{{ .GetName }} {{ end }}] - {{ .GetCreatedAt.Format "2006-01-02T15:04:05Z07:00" }}
+{{ end }}
+
+`))
+
+	newPullMarkdown = template.Must(template.New("newPull").Funcs(funcMap).Parse(
+		`# New Pull Request
+
+Fill in the title and the branch with the changes and save this file to create the pull request.
+The head is written as branch or user:branch for a branch of a fork. The pull request goes into
+the default branch unless the base is filled in.
+
+* {{ markform . "Title" }}
+* {{ markform . "Head" }}
+* {{ markform . "Base" }}
+* {{ markform . "Draft" }}
+
+{{ markform . "Body" }}
+
+`))
+
+	pullsFilterMarkdown = template.Must(template.New("pullsFilter").Funcs(funcMap).Parse(
+		`# Filter
+
+Use this filter to control the pull requests that are shown in this directory and the list. This file
+uses restful markdown. See the 0intro.md at the top level of this filesystem
+for more details on how to work with the format.
+
+The head is written as user:branch.
+
+* {{ markform . "State" }}
+* {{ markform . "Head" }}
+* {{ markform . "Base" }}
+* {{ markform . "Sort" }}
+* {{ markform . "Direction" }}
+
+`))
+)
+
+// mergeMethods are the ways that a pull request can be merged
+var mergeMethods = []string{"merge", "squash", "rebase"}
+
+// pullRequest is a pull request with its draft status, which
+//  isn't part of the go-github pull request yet.
+type pullRequest struct {
+	github.PullRequest
+	Draft bool `json:"draft"`
+}
+
+// getPull reads a pull request including whether it's a draft
+func getPull(owner string, repo string, n int) (*pullRequest, error) {
+	req, err := uncachedClient.NewRequest("GET", fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, n), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.shadow-cat-preview+json")
+
+	pr := &pullRequest{}
+	_, err = uncachedClient.Do(context.Background(), req, pr)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
+
+// setDraft converts a pull request to a draft or marks it ready for
+//  review. This can only be done with the GraphQL API.
+func setDraft(nodeID string, draft bool) error {
+	mutation := "markPullRequestReadyForReview"
+	if draft {
+		mutation = "convertPullRequestToDraft"
+	}
+
+	body := map[string]interface{}{
+		"query":     fmt.Sprintf("mutation($id: ID!) { %s(input: {pullRequestId: $id}) { clientMutationId } }", mutation),
+		"variables": map[string]string{"id": nodeID},
+	}
+	req, err := client.NewRequest("POST", "graphql", body)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	_, err = client.Do(context.Background(), req, &result)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Errors) != 0 {
+		return fmt.Errorf("%s", result.Errors[0].Message)
+	}
+
+	return nil
+}
+
+type PullsFilter struct {
+	State     string ` = () open () closed () all`
+	Head      string ` = ___`
+	Base      string ` = ___`
+	Sort      string ` = () created () updated () popularity () long-running`
+	Direction string ` = () desc () asc`
+}
+
+// PullsHandler handles the pulls directory of a repository showing
+//  the pull requests that match the filter.
+type PullsHandler struct {
+	dynamic.BasicDirHandler
+	options *github.PullRequestListOptions
+	filter  map[string]bool
+	mutex   sync.Mutex
+}
+
+func NewPullsHandler(repoPath string) {
+	handler := &PullsHandler{}
+	handler.options = &github.PullRequestListOptions{State: "open", Sort: "created", Direction: "desc"}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		if handler.filter == nil {
+			return true
+		}
+
+		_, ok := handler.filter[name]
+		return ok
+	}}
+
+	server.AddFileEntry(path.Join(repoPath, "pulls"), handler)
+	NewPullsCtl(path.Join(repoPath, "pulls"), handler)
+	NewPullsListHandler(path.Join(repoPath, "pulls"), handler)
+	server.AddFileEntry(path.Join(repoPath, "pulls", "new.md"), &NewPullCtl{ph: handler, readbuf: &bytes.Buffer{}})
+}
+
+func (ph *PullsHandler) WalkChild(name string, child string) (int, error) {
+	idx, _ := ph.BasicDirHandler.WalkChild(name, child)
+	if idx == -1 {
+		number, err := issueNumber(child)
+		if err != nil {
+			return idx, fmt.Errorf("Pull request %s not found", child)
+		}
+		repo := path.Base(path.Dir(name))
+		owner := path.Base(path.Dir(path.Dir(name)))
+
+		log.Printf("Checking if pull request %d exists\n", number)
+		pr, _, err := uncachedClient.PullRequests.Get(context.Background(), owner, repo, number)
+		if err != nil {
+			return idx, err
+		}
+
+		NewPull(owner, repo, pr)
+	}
+
+	return ph.BasicDirHandler.WalkChild(name, child)
+}
+
+// pullFiles are the extensions of the files of each pull request
+var pullFiles = []string{".md", ".json", ".diff", ".patch", ".files", ".review"}
+
+func (ph *PullsHandler) refresh(owner string, repo string) error {
+	ph.mutex.Lock()
+	defer ph.mutex.Unlock()
+
+	log.Printf("Listing pull requests for repo %s/%s\n", owner, repo)
+	ph.options.ListOptions = github.ListOptions{PerPage: 100}
+	pullsPath := path.Join("/repos", owner, repo, "pulls")
+	ph.filter = make(map[string]bool)
+	ph.filter[path.Join(pullsPath, "filter.md")] = true
+	ph.filter[path.Join(pullsPath, "filter.json")] = true
+	ph.filter[path.Join(pullsPath, "0list.md")] = true
+	ph.filter[path.Join(pullsPath, "new.md")] = true
+
+	for {
+		pulls, resp, err := uncachedClient.PullRequests.List(context.Background(), owner, repo, ph.options)
+		if err != nil {
+			return err
+		}
+
+		for _, pr := range pulls {
+			NewPull(owner, repo, pr)
+			for _, ext := range pullFiles {
+				ph.filter[path.Join(pullsPath, fmt.Sprintf("%d%s", pr.GetNumber(), ext))] = true
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		ph.options.Page = resp.NextPage
+	}
+
+	return nil
+}
+
+func (ph *PullsHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		repo := path.Base(path.Dir(name))
+		owner := path.Base(path.Dir(path.Dir(name)))
+		err := ph.refresh(owner, repo)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+	return ph.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (ph *PullsHandler) CreateChild(name string, child string) (int, error) {
+	if _, err := issueNumber(child); err == nil || path.Ext(child) != ".md" {
+		return -1, fmt.Errorf("New pull requests are created with a file such as new.md")
+	}
+
+	childPath := path.Join(name, child)
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return idx, nil
+	}
+
+	idx = server.AddFileEntry(childPath, &NewPullCtl{ph: ph, readbuf: &bytes.Buffer{}, temporary: true})
+
+	ph.mutex.Lock()
+	if ph.filter != nil {
+		ph.filter[childPath] = true
+	}
+	ph.mutex.Unlock()
+
+	return idx, nil
+}
+
+// PullsCtl handles the filter.md of the pulls directory
+type PullsCtl struct {
+	ph       *PullsHandler
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mutex    sync.Mutex
+}
+
+func NewPullsCtl(pullsPath string, ph *PullsHandler) {
+	handler := &PullsCtl{ph: ph, readbuf: &bytes.Buffer{}, writebuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(pullsPath, "filter.md"), handler)
+	NewFormJSONHandler(path.Join(pullsPath, "filter.json"), handler)
+
+	pullsFilterMarkdown.Execute(handler.readbuf, handler.filter())
+}
+
+// filter returns the current filter of the pull requests
+func (pc *PullsCtl) filter() PullsFilter {
+	return PullsFilter{State: pc.ph.options.State, Head: pc.ph.options.Head, Base: pc.ph.options.Base, Sort: pc.ph.options.Sort, Direction: pc.ph.options.Direction}
+}
+
+// apply changes the pull request filter and refreshes the pull requests
+func (pc *PullsCtl) apply(name string, pf *PullsFilter) error {
+	pc.ph.options.State = pf.State
+	pc.ph.options.Head = pf.Head
+	pc.ph.options.Base = pf.Base
+	pc.ph.options.Sort = pf.Sort
+	pc.ph.options.Direction = pf.Direction
+
+	return pc.ph.refresh(path.Base(path.Dir(path.Dir(path.Dir(name)))), path.Base(path.Dir(path.Dir(name))))
+}
+
+func (pc *PullsCtl) loadForm(name string) (interface{}, error) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pf := pc.filter()
+	return &pf, nil
+}
+
+func (pc *PullsCtl) saveForm(name string, edited interface{}) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	return pc.apply(name, edited.(*PullsFilter))
+}
+
+func (pc *PullsCtl) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the pulls filter.md file")
+}
+
+func (pc *PullsCtl) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if pc.writefid != 0 {
+			return fmt.Errorf("Filter doesn't support concurrent writes")
+		}
+
+		pc.writefid = fid
+		pc.writebuf = &bytes.Buffer{}
+
+		pullsFilterMarkdown.Execute(pc.writebuf, pc.filter())
+	}
+
+	if mode == protocol.OREAD {
+		pc.readbuf = &bytes.Buffer{}
+
+		pullsFilterMarkdown.Execute(pc.readbuf, pc.filter())
+	}
+
+	return nil
+}
+
+func (pc *PullsCtl) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a pulls filter.md is not supported")
+}
+
+func (pc *PullsCtl) Stat(name string) (protocol.Dir, error) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(pc.readbuf.Len())}, nil
+}
+
+func (pc *PullsCtl) Wstat(name string, dir protocol.Dir) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pc.writebuf.Truncate(int(dir.Length))
+	return nil
+}
+
+func (pc *PullsCtl) Remove(name string) error {
+	return fmt.Errorf("Removing pulls filter.md isn't supported.")
+}
+
+func (pc *PullsCtl) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if offset >= int64(pc.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(pc.readbuf.Len()) {
+		return pc.readbuf.Bytes()[offset:], nil
+	}
+
+	return pc.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (pc *PullsCtl) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if fid != pc.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := pc.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (pc *PullsCtl) Clunk(name string, fid protocol.FID) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if fid != pc.writefid {
+		return nil
+	}
+	pc.writefid = 0
+
+	if len(pc.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	pf := PullsFilter{}
+	err := markform.Unmarshal(markform.Parse(pc.writebuf.Bytes()), &pf)
+	if err != nil {
+		return err
+	}
+
+	return pc.apply(name, &pf)
+}
+
+// PullForm holds the editable fields of a pull request. Choosing a
+//  merge method merges the pull request when it is saved.
+type PullForm struct {
+	Title     string   ` = ___`
+	State     string   ` = () open () closed`
+	Base      string   ` = ___`
+	Draft     bool     ` = []`
+	Labels    []string ` = [] ...`
+	Reviewers []string ` = ,, ___`
+	Body      string   ` = <<<`
+	Merge     string   ` = () ...`
+
+	repoLabels []string
+}
+
+func (f PullForm) Options(fn string) []string {
+	if fn == "Labels" {
+		if f.repoLabels == nil {
+			return []string{}
+		}
+		return f.repoLabels
+	}
+	if fn == "Merge" {
+		return mergeMethods
+	}
+	return nil
+}
+
+// Pull handles the N.md of a pull request with its editable fields
+//  followed by the conversation comments.
+type Pull struct {
+	mtime    time.Time
+	Pull     *pullRequest
+	Checks   *commitChecks
+	Comments []Comment
+	Form     PullForm
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mutex    sync.Mutex
+}
+
+func NewPull(owner string, repo string, pr *github.PullRequest) {
+	pullPath := path.Join("/repos", owner, repo, "pulls", fmt.Sprintf("%d", pr.GetNumber()))
+	mtime := pr.GetUpdatedAt()
+
+	pull := &Pull{readbuf: &bytes.Buffer{}, mtime: mtime}
+	server.AddFileEntry(pullPath+".md", pull)
+	NewFormJSONHandler(pullPath+".json", pull)
+	server.AddFileEntry(pullPath+".diff", &PullRawHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}, mtime: mtime})
+	server.AddFileEntry(pullPath+".patch", &PullRawHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}, mtime: mtime})
+	server.AddFileEntry(pullPath+".files", &PullFilesHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}, mtime: mtime})
+	server.AddFileEntry(pullPath+".review", &PullReview{readbuf: &bytes.Buffer{}, mtime: mtime})
+}
+
+// splitPullPath splits the name of a file of a pull request into the
+//  owner, repo and pull request number.
+func splitPullPath(name string) (string, string, int, error) {
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+	repo := path.Base(path.Dir(path.Dir(name)))
+	n, err := issueNumber(name)
+	return owner, repo, n, err
+}
+
+func (p *Pull) load(owner string, repo string, n int) error {
+	log.Printf("Loading pull request %d\n", n)
+	pr, err := getPull(owner, repo, n)
+	if err != nil {
+		return err
+	}
+	p.mtime = pr.GetUpdatedAt()
+	p.Pull = pr
+
+	p.Form.Title = pr.GetTitle()
+	p.Form.State = pr.GetState()
+	p.Form.Base = pr.Base.GetRef()
+	p.Form.Draft = pr.Draft
+	p.Form.Body = pr.GetBody()
+	p.Form.Merge = ""
+	p.Form.Reviewers = []string{}
+	for _, u := range pr.RequestedReviewers {
+		p.Form.Reviewers = append(p.Form.Reviewers, u.GetLogin())
+	}
+
+	p.Form.repoLabels, err = repoLabels(owner, repo)
+	if err != nil {
+		return err
+	}
+	p.Form.Labels = []string{}
+	for _, l := range pr.Labels {
+		p.Form.Labels = append(p.Form.Labels, l.GetName())
+
+		found := false
+		for _, rl := range p.Form.repoLabels {
+			if rl == l.GetName() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.Form.repoLabels = append(p.Form.repoLabels, l.GetName())
+		}
+	}
+
+	return nil
+}
+
+func (p *Pull) loadForm(name string) (interface{}, error) {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	err = p.load(owner, repo, n)
+	if err != nil {
+		return nil, err
+	}
+
+	form := p.Form
+	return &form, nil
+}
+
+func (p *Pull) saveForm(name string, edited interface{}) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	form := edited.(*PullForm)
+	return p.save(owner, repo, n, markform.Compare(&p.Form, form), form)
+}
+
+// save applies the changes of the edited form to the pull request
+//  and then merges it if a merge method was chosen.
+func (p *Pull) save(owner string, repo string, n int, changes markform.Changes, form *PullForm) error {
+	for _, c := range changes {
+		log.Printf("Changing %s of pull request %d from %v to %v\n", c.Field, n, c.Old, c.New)
+	}
+
+	edit := &github.PullRequest{}
+	if changes.Has("Title") {
+		edit.Title = &form.Title
+	}
+	if changes.Has("Body") {
+		edit.Body = &form.Body
+	}
+	if changes.Has("State") {
+		edit.State = &form.State
+	}
+	if changes.Has("Base") {
+		edit.Base = &github.PullRequestBranch{Ref: &form.Base}
+	}
+	if changes.Has("Title") || changes.Has("Body") || changes.Has("State") || changes.Has("Base") {
+		_, _, err := client.PullRequests.Edit(context.Background(), owner, repo, n, edit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if changes.Has("Labels") {
+		_, _, err := client.Issues.ReplaceLabelsForIssue(context.Background(), owner, repo, n, form.Labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c, ok := changes.Get("Reviewers"); ok {
+		if len(c.Added) != 0 {
+			_, _, err := client.PullRequests.RequestReviewers(context.Background(), owner, repo, n, github.ReviewersRequest{Reviewers: c.Added})
+			if err != nil {
+				return err
+			}
+		}
+		if len(c.Removed) != 0 {
+			_, err := client.PullRequests.RemoveReviewers(context.Background(), owner, repo, n, github.ReviewersRequest{Reviewers: c.Removed})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if changes.Has("Draft") {
+		err := setDraft(p.Pull.GetNodeID(), form.Draft)
+		if err != nil {
+			return err
+		}
+	}
+
+	if form.Merge != "" {
+		log.Printf("Merging pull request %d with %s\n", n, form.Merge)
+		result, _, err := client.PullRequests.Merge(context.Background(), owner, repo, n, "", &github.PullRequestOptions{MergeMethod: form.Merge, SHA: p.Pull.Head.GetSHA()})
+		if err != nil {
+			return err
+		}
+		if !result.GetMerged() {
+			return fmt.Errorf("Pull request %d wasn't merged: %s", n, result.GetMessage())
+		}
+		form.Merge = ""
+	}
+
+	p.Form = *form
+
+	return nil
+}
+
+func (p *Pull) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if offset >= int64(p.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(p.readbuf.Len()) {
+		return p.readbuf.Bytes()[offset:], nil
+	}
+
+	return p.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (p *Pull) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if fid != p.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := p.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (p *Pull) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of pull requests")
+}
+
+func (p *Pull) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if mode == protocol.OREAD || p.Pull == nil {
+		p.readbuf.Truncate(0)
+		err = p.load(owner, repo, n)
+		if err != nil {
+			return err
+		}
+
+		p.Checks = loadChecksForDisplay(owner, repo, p.Pull.Head.GetSHA())
+
+		err = pullMarkdown.Execute(p.readbuf, p)
+		if err != nil {
+			return err
+		}
+
+		p.Comments, err = loadComments(owner, repo, n, &p.mtime, p.readbuf)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if p.writefid != 0 {
+			return fmt.Errorf("Pull request doesn't support concurrent writes")
+		}
+
+		p.writefid = fid
+		p.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (p *Pull) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a pull request is not supported")
+}
+
+func (p *Pull) Stat(name string) (protocol.Dir, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(p.readbuf.Len()), Mtime: unixTime(p.mtime)}, nil
+}
+
+func (p *Pull) Wstat(name string, dir protocol.Dir) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.writebuf != nil {
+		p.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (p *Pull) Remove(name string) error {
+	return fmt.Errorf("Removing pull requests isn't supported.")
+}
+
+func (p *Pull) Clunk(name string, fid protocol.FID) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if fid != p.writefid {
+		return nil
+	}
+	p.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(p.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &PullForm{}
+	tree := markform.Parse(p.writebuf.Bytes())
+	comments := splitComments(tree)
+
+	changes, err := markform.Diff(&p.Form, tree, form)
+	if err != nil {
+		return err
+	}
+
+	err = p.save(owner, repo, n, changes, form)
+	if err != nil {
+		return err
+	}
+
+	p.Comments, err = saveComments(owner, repo, n, p.Comments, comments)
+	return err
+}
+
+// PullRawHandler handles the diff and patch files of a pull request
+type PullRawHandler struct {
+	dynamic.StaticFileHandler
+	mtime time.Time
+	mu    sync.Mutex
+}
+
+func (prh *PullRawHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	prh.mu.Lock()
+	defer prh.mu.Unlock()
+
+	options := github.RawOptions{Type: github.Diff}
+	if path.Ext(name) == ".patch" {
+		options.Type = github.Patch
+	}
+
+	log.Printf("Reading the %s of pull request %d\n", path.Ext(name)[1:], n)
+	content, _, err := uncachedClient.PullRequests.GetRaw(context.Background(), owner, repo, n, options)
+	if err != nil {
+		return err
+	}
+
+	prh.StaticFileHandler.Content = []byte(content)
+
+	return prh.StaticFileHandler.Open(name, fid, mode)
+}
+
+func (prh *PullRawHandler) Stat(name string) (protocol.Dir, error) {
+	prh.mu.Lock()
+	defer prh.mu.Unlock()
+
+	dir, err := prh.StaticFileHandler.Stat(name)
+	dir.Mtime = unixTime(prh.mtime)
+	return dir, err
+}
+
+// PullFilesHandler handles the N.files listing of the files
+//  changed by a pull request.
+type PullFilesHandler struct {
+	dynamic.StaticFileHandler
+	mtime time.Time
+	mu    sync.Mutex
+}
+
+func (pfh *PullFilesHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	pfh.mu.Lock()
+	defer pfh.mu.Unlock()
+
+	buf := bytes.Buffer{}
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		log.Printf("Listing files of pull request %d\n", n)
+		files, resp, err := uncachedClient.PullRequests.ListFiles(context.Background(), owner, repo, n, options)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			fmt.Fprintf(&buf, "%s\t+%d -%d\t%s\n", f.GetStatus(), f.GetAdditions(), f.GetDeletions(), f.GetFilename())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	pfh.StaticFileHandler.Content = buf.Bytes()
+
+	return pfh.StaticFileHandler.Open(name, fid, mode)
+}
+
+func (pfh *PullFilesHandler) Stat(name string) (protocol.Dir, error) {
+	pfh.mu.Lock()
+	defer pfh.mu.Unlock()
+
+	dir, err := pfh.StaticFileHandler.Stat(name)
+	dir.Mtime = unixTime(pfh.mtime)
+	return dir, err
+}
+
+// PullsListHandler handles the 0list.md of the pulls directory
+type PullsListHandler struct {
+	dynamic.StaticFileHandler
+	ph *PullsHandler
+	mu sync.Mutex
+}
+
+func NewPullsListHandler(pullsPath string, ph *PullsHandler) {
+	server.AddFileEntry(path.Join(pullsPath, "0list.md"), &PullsListHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}, ph: ph})
+}
+
+func (plh *PullsListHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	plh.mu.Lock()
+	defer plh.mu.Unlock()
+
+	repo := path.Base(path.Dir(path.Dir(name)))
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+
+	plh.ph.mutex.Lock()
+	defer plh.ph.mutex.Unlock()
+
+	plh.ph.options.ListOptions = github.ListOptions{PerPage: 100}
+	list := []*github.PullRequest{}
+
+	for {
+		log.Printf("Listing pull requests for repo %s\n", repo)
+		pulls, resp, err := uncachedClient.PullRequests.List(context.Background(), owner, repo, plh.ph.options)
+		if err != nil {
+			return err
+		}
+
+		list = append(list, pulls...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		plh.ph.options.Page = resp.NextPage
+	}
+
+	buf := bytes.Buffer{}
+	err := pullsListMarkdown.Execute(&buf, list)
+	if err != nil {
+		return err
+	}
+
+	plh.StaticFileHandler.Content = buf.Bytes()
+
+	return plh.StaticFileHandler.Open(name, fid, mode)
+}
+
+// NewPullForm holds the fields of a new pull request
+type NewPullForm struct {
+	Title string `* = ___`
+	Head  string `* = ___`
+	Base  string ` = ___`
+	Draft bool   ` = []`
+	Body  string ` = <<<`
+}
+
+// NewPullCtl handles the new.md of the pulls directory, or any other
+//  new file that's created there, which creates a pull request when
+//  it's saved. Other new files are removed once the pull request is
+//  created so that it shows up as N.md instead.
+type NewPullCtl struct {
+	ph        *PullsHandler
+	temporary bool
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mutex    sync.Mutex
+}
+
+func (npc *NewPullCtl) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the %s file", path.Base(name))
+}
+
+func (npc *NewPullCtl) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	npc.mutex.Lock()
+	defer npc.mutex.Unlock()
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if npc.writefid != 0 {
+			return fmt.Errorf("New pull request doesn't support concurrent writes")
+		}
+
+		npc.writefid = fid
+		npc.writebuf = &bytes.Buffer{}
+	}
+
+	if mode == protocol.OREAD {
+		npc.readbuf = &bytes.Buffer{}
+
+		newPullMarkdown.Execute(npc.readbuf, NewPullForm{})
+	}
+
+	return nil
+}
+
+func (npc *NewPullCtl) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of %s is not supported", path.Base(name))
+}
+
+func (npc *NewPullCtl) Stat(name string) (protocol.Dir, error) {
+	npc.mutex.Lock()
+	defer npc.mutex.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(npc.readbuf.Len())}, nil
+}
+
+func (npc *NewPullCtl) Wstat(name string, dir protocol.Dir) error {
+	npc.mutex.Lock()
+	defer npc.mutex.Unlock()
+
+	if npc.writebuf != nil {
+		npc.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (npc *NewPullCtl) Remove(name string) error {
+	if !npc.temporary {
+		return fmt.Errorf("Removing %s isn't supported.", path.Base(name))
+	}
+	return nil
+}
+
+func (npc *NewPullCtl) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	npc.mutex.Lock()
+	defer npc.mutex.Unlock()
+
+	if offset >= int64(npc.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(npc.readbuf.Len()) {
+		return npc.readbuf.Bytes()[offset:], nil
+	}
+
+	return npc.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (npc *NewPullCtl) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	npc.mutex.Lock()
+	defer npc.mutex.Unlock()
+
+	if fid != npc.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := npc.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (npc *NewPullCtl) Clunk(name string, fid protocol.FID) error {
+	repo := path.Base(path.Dir(path.Dir(name)))
+	owner := path.Base(path.Dir(path.Dir(path.Dir(name))))
+
+	npc.mutex.Lock()
+	defer npc.mutex.Unlock()
+
+	if fid != npc.writefid {
+		return nil
+	}
+	npc.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(npc.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &NewPullForm{}
+	err := markform.Unmarshal(markform.Parse(npc.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	pr, err := createPull(owner, repo, form)
+	if err != nil {
+		return err
+	}
+
+	NewPull(owner, repo, pr)
+	npc.ph.mutex.Lock()
+	if npc.ph.filter != nil {
+		for _, ext := range pullFiles {
+			npc.ph.filter[path.Join(path.Dir(name), fmt.Sprintf("%d%s", pr.GetNumber(), ext))] = true
+		}
+	}
+	npc.ph.mutex.Unlock()
+
+	if npc.temporary {
+		server.RemoveFileEntry(name)
+	}
+
+	return nil
+}
+
+// createPull creates a pull request from the form, which isn't
+//  done with go-github since it can't create drafts yet.
+func createPull(owner string, repo string, form *NewPullForm) (*github.PullRequest, error) {
+	if strings.TrimSpace(form.Title) == "" {
+		return nil, fmt.Errorf("The Title of the pull request is required")
+	}
+	if strings.TrimSpace(form.Head) == "" {
+		return nil, fmt.Errorf("The Head branch of the pull request is required")
+	}
+
+	if form.Base == "" {
+		log.Printf("Reading repo %s/%s\n", owner, repo)
+		r, _, err := client.Repositories.Get(context.Background(), owner, repo)
+		if err != nil {
+			return nil, err
+		}
+		form.Base = r.GetDefaultBranch()
+	}
+
+	body := struct {
+		Title string `json:"title"`
+		Head  string `json:"head"`
+		Base  string `json:"base"`
+		Body  string `json:"body,omitempty"`
+		Draft bool   `json:"draft"`
+	}{form.Title, form.Head, form.Base, form.Body, form.Draft}
+
+	req, err := client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/pulls", owner, repo), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.shadow-cat-preview+json")
+
+	log.Printf("Creating a pull request from %s into %s in %s/%s\n", form.Head, form.Base, owner, repo)
+	pr := &github.PullRequest{}
+	_, err = client.Do(context.Background(), req, pr)
+	if err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
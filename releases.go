@@ -0,0 +1,1036 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	releaseMarkdown = template.Must(template.New("release").Funcs(funcMap).Parse(
+		`# Release {{ .Release.GetTagName }}
+
+* {{ markform .Form "Name" }}
+* Author: [{{ .Release.Author.GetLogin }}](../../../../{{ .Release.Author.GetLogin }})
+* Created: {{ .Release.GetCreatedAt.Format "2006-01-02T15:04:05Z07:00" }}
+* Published: {{ .Release.GetPublishedAt.Format "2006-01-02T15:04:05Z07:00" }}
+* {{ markform .Form "Target" }}
+* {{ markform .Form "Draft" }}
+* {{ markform .Form "Prerelease" }}
+
+{{ markform .Form "Body" }}
+
+Check the box and save to replace the notes with ones generated from the changes since the
+previous release.
+
+* {{ markform .Form "GenerateNotes" }}
+
+## Assets
+
+Copy a file into this directory to upload it as an asset and remove it to delete the asset.
+
+{{ range .Release.Assets }}  * {{ .GetName }} - {{ .GetSize }} bytes - {{ .GetDownloadCount }} downloads
+{{ end }}
+`))
+
+	newReleaseMarkdown = template.Must(template.New("newrelease").Funcs(funcMap).Parse(
+		`# New Release
+
+Fill in the tag and save to publish the release. The tag is created from the
+target if it doesn't exist yet.
+
+* {{ markform .Form "Tag" }}
+* {{ markform .Form "Name" }}
+* {{ markform .Form "Target" }}
+* {{ markform .Form "Draft" }}
+* {{ markform .Form "Prerelease" }}
+
+{{ markform .Form "Body" }}
+
+Check the box to have the notes generated from the changes since the previous
+release instead.
+
+* {{ markform .Form "GenerateNotes" }}
+`))
+)
+
+// releaseByTag finds the release of a tag. Draft releases can't be
+//  looked up by their tag so they are found in the list of releases.
+func releaseByTag(owner string, repo string, tag string) (*github.RepositoryRelease, error) {
+	log.Printf("Reading release %s of %s/%s\n", tag, owner, repo)
+	release, resp, err := uncachedClient.Repositories.GetReleaseByTag(context.Background(), owner, repo, tag)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		return release, err
+	}
+
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		log.Printf("Listing releases of %s/%s\n", owner, repo)
+		releases, resp, err := uncachedClient.Repositories.ListReleases(context.Background(), owner, repo, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range releases {
+			if r.GetTagName() == tag {
+				return r, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	return nil, fmt.Errorf("Release %s not found", tag)
+}
+
+// generateNotes generates release notes with the changes since the
+//  previous release, which go-github can't do yet.
+func generateNotes(owner string, repo string, tag string, target string) (string, error) {
+	body := struct {
+		TagName string `json:"tag_name"`
+		Target  string `json:"target_commitish,omitempty"`
+	}{tag, target}
+
+	req, err := client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/releases/generate-notes", owner, repo), body)
+	if err != nil {
+		return "", err
+	}
+
+	notes := struct {
+		Body string `json:"body"`
+	}{}
+	log.Printf("Generating release notes for %s of %s/%s\n", tag, owner, repo)
+	_, err = client.Do(context.Background(), req, &notes)
+	if err != nil {
+		return "", err
+	}
+
+	return notes.Body, nil
+}
+
+// splitReleasePath splits the name of a file in a release directory
+//  into the owner, repo and tag of the release.
+func splitReleasePath(name string) (string, string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 6)
+	for len(parts) < 5 {
+		parts = append(parts, "")
+	}
+	return parts[1], parts[2], refName(parts[4])
+}
+
+// ReleasesHandler handles the releases directory of a repository,
+//  which has a directory for each release. Making a new directory
+//  publishes a release of the tag with the directory's name and
+//  saving a new release.md publishes the release in the form.
+type ReleasesHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewReleasesHandler(repoPath string) {
+	handler := &ReleasesHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(path.Join(repoPath, "releases"), handler)
+}
+
+func (rh *ReleasesHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := rh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		owner := path.Base(path.Dir(path.Dir(name)))
+		repo := path.Base(path.Dir(name))
+
+		_, err = releaseByTag(owner, repo, refName(child))
+		if err != nil {
+			return -1, err
+		}
+
+		idx = rh.add(path.Join(name, child))
+	}
+
+	return idx, err
+}
+
+// add adds the directory of a release
+func (rh *ReleasesHandler) add(releasePath string) int {
+	idx := NewReleaseDirHandler(releasePath)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if rh.filter != nil {
+		rh.filter[releasePath] = true
+	}
+	return idx
+}
+
+func (rh *ReleasesHandler) refresh(name string) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	filter := make(map[string]bool)
+	options := &github.ListOptions{PerPage: 100}
+
+	for {
+		log.Printf("Listing releases of %s/%s\n", owner, repo)
+		releases, resp, err := uncachedClient.Repositories.ListReleases(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+
+		for _, release := range releases {
+			releasePath := path.Join(name, refFileName(release.GetTagName()))
+			NewReleaseDirHandler(releasePath)
+			filter[releasePath] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	rh.mu.Lock()
+	rh.filter = filter
+	rh.mu.Unlock()
+
+	return nil
+}
+
+func (rh *ReleasesHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := rh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return rh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (rh *ReleasesHandler) CreateDir(name string, child string) (int, error) {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+	tag := refName(child)
+
+	err := createRelease(owner, repo, &NewReleaseForm{Tag: tag, Name: tag})
+	if err != nil {
+		return -1, err
+	}
+
+	return rh.add(path.Join(name, child)), nil
+}
+
+func (rh *ReleasesHandler) CreateChild(name string, child string) (int, error) {
+	if child != "release.md" {
+		return -1, fmt.Errorf("New releases are created with a release.md file or a directory named after the tag")
+	}
+
+	childPath := path.Join(name, child)
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return idx, nil
+	}
+
+	handler := &NewReleaseCtl{rh: rh, readbuf: &bytes.Buffer{}}
+	err := newReleaseMarkdown.Execute(handler.readbuf, handler)
+	if err != nil {
+		return -1, err
+	}
+	idx = server.AddFileEntry(childPath, handler)
+
+	rh.mu.Lock()
+	if rh.filter != nil {
+		rh.filter[childPath] = true
+	}
+	rh.mu.Unlock()
+
+	return idx, nil
+}
+
+// NewReleaseForm holds the fields of a release that is published
+//  with a release.md in the releases directory. GenerateNotes
+//  has GitHub write the notes from the changes since the previous
+//  release.
+type NewReleaseForm struct {
+	Tag           string ` = ___`
+	Name          string ` = ___`
+	Target        string ` = ___`
+	Draft         bool   ` = []`
+	Prerelease    bool   ` = []`
+	Body          string ` = <<<`
+	GenerateNotes bool   ` = []`
+}
+
+// createRelease publishes a release of the tag in the form, which
+//  go-github can't do with generated notes yet.
+func createRelease(owner string, repo string, form *NewReleaseForm) error {
+	if strings.TrimSpace(form.Tag) == "" {
+		return fmt.Errorf("The Tag of the release is required")
+	}
+
+	body := struct {
+		TagName              string `json:"tag_name"`
+		Target               string `json:"target_commitish,omitempty"`
+		Name                 string `json:"name,omitempty"`
+		Body                 string `json:"body,omitempty"`
+		Draft                bool   `json:"draft"`
+		Prerelease           bool   `json:"prerelease"`
+		GenerateReleaseNotes bool   `json:"generate_release_notes"`
+	}{form.Tag, form.Target, form.Name, form.Body, form.Draft, form.Prerelease, form.GenerateNotes}
+
+	req, err := client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/releases", owner, repo), body)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Creating release %s of %s/%s\n", form.Tag, owner, repo)
+	_, err = client.Do(context.Background(), req, nil)
+	return err
+}
+
+// NewReleaseCtl handles a release.md in the releases directory.
+//  Saving it publishes the release and the file is replaced by
+//  the directory of the release.
+type NewReleaseCtl struct {
+	Form NewReleaseForm
+
+	rh       *ReleasesHandler
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func (nrc *NewReleaseCtl) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the release.md file")
+}
+
+func (nrc *NewReleaseCtl) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if nrc.writefid != 0 {
+			return fmt.Errorf("New release doesn't support concurrent writes")
+		}
+
+		nrc.writefid = fid
+		nrc.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (nrc *NewReleaseCtl) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if offset >= int64(nrc.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(nrc.readbuf.Len()) {
+		return nrc.readbuf.Bytes()[offset:], nil
+	}
+
+	return nrc.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (nrc *NewReleaseCtl) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if fid != nrc.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := nrc.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (nrc *NewReleaseCtl) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a release.md is not supported")
+}
+
+func (nrc *NewReleaseCtl) Stat(name string) (protocol.Dir, error) {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(nrc.readbuf.Len())}, nil
+}
+
+func (nrc *NewReleaseCtl) Wstat(name string, dir protocol.Dir) error {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if nrc.writebuf != nil {
+		nrc.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (nrc *NewReleaseCtl) Remove(name string) error {
+	// The release isn't published until it is saved
+	return nil
+}
+
+func (nrc *NewReleaseCtl) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if fid != nrc.writefid {
+		return nil
+	}
+	nrc.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(nrc.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := NewReleaseForm{}
+	err := markform.Unmarshal(markform.Parse(nrc.writebuf.Bytes()), &form)
+	if err != nil {
+		return err
+	}
+	form.Tag = strings.TrimSpace(form.Tag)
+
+	err = createRelease(owner, repo, &form)
+	if err != nil {
+		return err
+	}
+
+	nrc.rh.add(path.Join(path.Dir(name), refFileName(form.Tag)))
+	server.RemoveFileEntry(name)
+	return nil
+}
+
+// ReleaseDirHandler handles the directory of a release, which has
+//  the release.md, the assets and the source archives of the release.
+type ReleaseDirHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mtime  time.Time
+	mu     sync.Mutex
+}
+
+func NewReleaseDirHandler(releasePath string) int {
+	handler := &ReleaseDirHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	idx := server.AddFileEntry(releasePath, handler)
+	NewReleaseHandler(releasePath)
+	NewArchiveHandlers(releasePath)
+	return idx
+}
+
+func (rdh *ReleaseDirHandler) refresh(name string) error {
+	owner, repo, tag := splitReleasePath(name)
+
+	release, err := releaseByTag(owner, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	filter := make(map[string]bool)
+	filter[path.Join(name, "release.md")] = true
+	filter[path.Join(name, "release.json")] = true
+	for _, fn := range archiveFiles {
+		filter[path.Join(name, fn)] = true
+	}
+	for _, asset := range release.Assets {
+		assetPath := path.Join(name, asset.GetName())
+		NewReleaseAssetHandler(assetPath, asset)
+		filter[assetPath] = true
+	}
+
+	rdh.mu.Lock()
+	rdh.filter = filter
+	rdh.mtime = release.GetPublishedAt().Time
+	if rdh.mtime.IsZero() {
+		rdh.mtime = release.GetCreatedAt().Time
+	}
+	rdh.mu.Unlock()
+
+	return nil
+}
+
+func (rdh *ReleaseDirHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := rdh.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		err = rdh.refresh(name)
+		if err != nil {
+			return -1, err
+		}
+		return rdh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (rdh *ReleaseDirHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := rdh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return rdh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (rdh *ReleaseDirHandler) CreateChild(name string, child string) (int, error) {
+	childPath := path.Join(name, child)
+
+	// Creating an asset that exists replaces it
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx == -1 {
+		idx = server.AddFileEntry(childPath, &ReleaseAssetHandler{})
+	}
+
+	rdh.mu.Lock()
+	if rdh.filter != nil {
+		rdh.filter[childPath] = true
+	}
+	rdh.mu.Unlock()
+
+	return idx, nil
+}
+
+func (rdh *ReleaseDirHandler) Stat(name string) (protocol.Dir, error) {
+	rdh.mu.Lock()
+	defer rdh.mu.Unlock()
+
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTDIR}, Mtime: unixTime(rdh.mtime)}, nil
+}
+
+// ReleaseForm holds the editable fields of a release. Checking
+//  GenerateNotes replaces the body with generated release notes.
+type ReleaseForm struct {
+	Name          string ` = ___`
+	Target        string ` = ___`
+	Draft         bool   ` = []`
+	Prerelease    bool   ` = []`
+	Body          string ` = <<<`
+	GenerateNotes bool   ` = []`
+}
+
+// ReleaseHandler handles the release.md of a release
+type ReleaseHandler struct {
+	Release *github.RepositoryRelease
+	Form    ReleaseForm
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewReleaseHandler(releasePath string) {
+	handler := &ReleaseHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(releasePath, "release.md"), handler)
+	NewFormJSONHandler(path.Join(releasePath, "release.json"), handler)
+}
+
+func (rh *ReleaseHandler) load(owner string, repo string, tag string) error {
+	release, err := releaseByTag(owner, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	rh.Release = release
+	rh.Form.Name = release.GetName()
+	rh.Form.Target = release.GetTargetCommitish()
+	rh.Form.Draft = release.GetDraft()
+	rh.Form.Prerelease = release.GetPrerelease()
+	rh.Form.Body = release.GetBody()
+	rh.Form.GenerateNotes = false
+
+	return nil
+}
+
+func (rh *ReleaseHandler) loadForm(name string) (interface{}, error) {
+	owner, repo, tag := splitReleasePath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	err := rh.load(owner, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	form := rh.Form
+	return &form, nil
+}
+
+func (rh *ReleaseHandler) saveForm(name string, edited interface{}) error {
+	owner, repo, tag := splitReleasePath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	form := edited.(*ReleaseForm)
+	return rh.save(owner, repo, tag, markform.Compare(&rh.Form, form), form)
+}
+
+// save applies the changes of the edited form to the release in a single edit
+func (rh *ReleaseHandler) save(owner string, repo string, tag string, changes markform.Changes, form *ReleaseForm) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	edit := &github.RepositoryRelease{}
+	if form.GenerateNotes {
+		notes, err := generateNotes(owner, repo, tag, form.Target)
+		if err != nil {
+			return err
+		}
+		form.Body = notes
+		edit.Body = &form.Body
+	}
+
+	if changes.Has("Name") {
+		edit.Name = &form.Name
+	}
+	if changes.Has("Target") {
+		edit.TargetCommitish = &form.Target
+	}
+	if changes.Has("Draft") {
+		edit.Draft = &form.Draft
+	}
+	if changes.Has("Prerelease") {
+		edit.Prerelease = &form.Prerelease
+	}
+	if changes.Has("Body") {
+		edit.Body = &form.Body
+	}
+
+	log.Printf("Editing release %s of %s/%s\n", tag, owner, repo)
+	_, _, err := client.Repositories.EditRelease(context.Background(), owner, repo, rh.Release.GetID(), edit)
+	if err != nil {
+		return err
+	}
+
+	form.GenerateNotes = false
+	rh.Form = *form
+
+	return nil
+}
+
+func (rh *ReleaseHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the release.md file")
+}
+
+func (rh *ReleaseHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, tag := splitReleasePath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if mode == protocol.OREAD || rh.Release == nil {
+		err := rh.load(owner, repo, tag)
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.Buffer{}
+		err = releaseMarkdown.Execute(&buf, rh)
+		if err != nil {
+			return err
+		}
+		rh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if rh.writefid != 0 {
+			return fmt.Errorf("Release doesn't support concurrent writes")
+		}
+
+		rh.writefid = fid
+		rh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (rh *ReleaseHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if offset >= int64(rh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(rh.readbuf.Len()) {
+		return rh.readbuf.Bytes()[offset:], nil
+	}
+
+	return rh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (rh *ReleaseHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if fid != rh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := rh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (rh *ReleaseHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a release.md is not supported")
+}
+
+func (rh *ReleaseHandler) Stat(name string) (protocol.Dir, error) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(rh.readbuf.Len())}, nil
+}
+
+func (rh *ReleaseHandler) Wstat(name string, dir protocol.Dir) error {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if rh.writebuf != nil {
+		rh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (rh *ReleaseHandler) Remove(name string) error {
+	return fmt.Errorf("Removing release.md isn't supported.")
+}
+
+func (rh *ReleaseHandler) Clunk(name string, fid protocol.FID) error {
+	owner, repo, tag := splitReleasePath(name)
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if fid != rh.writefid {
+		return nil
+	}
+	rh.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(rh.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := &ReleaseForm{}
+	changes, err := markform.Diff(&rh.Form, markform.Parse(rh.writebuf.Bytes()), form)
+	if err != nil {
+		return err
+	}
+
+	return rh.save(owner, repo, tag, changes, form)
+}
+
+// ReleaseAssetHandler handles an asset of a release. The asset is
+//  downloaded when it's opened and writing it uploads a new asset
+//  in its place.
+type ReleaseAssetHandler struct {
+	id      int64
+	size    int64
+	mtime   time.Time
+	content []byte
+
+	writefid protocol.FID
+	writebuf []byte
+	mu       sync.Mutex
+}
+
+func NewReleaseAssetHandler(assetPath string, asset github.ReleaseAsset) {
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool {
+		if f.Name != assetPath {
+			return false
+		}
+
+		// Keep the existing asset up to date
+		if rah, ok := f.Handler.(*ReleaseAssetHandler); ok {
+			rah.update(asset)
+		}
+		return true
+	})
+
+	if idx == -1 {
+		rah := &ReleaseAssetHandler{}
+		rah.update(asset)
+		server.AddFileEntry(assetPath, rah)
+	}
+}
+
+func (rah *ReleaseAssetHandler) update(asset github.ReleaseAsset) {
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	if rah.id != asset.GetID() {
+		rah.content = nil
+	}
+	rah.id = asset.GetID()
+	rah.size = int64(asset.GetSize())
+	rah.mtime = asset.GetUpdatedAt().Time
+}
+
+func (rah *ReleaseAssetHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of a release asset")
+}
+
+func (rah *ReleaseAssetHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, _ := splitReleasePath(name)
+
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if rah.writefid != 0 {
+			return fmt.Errorf("%s doesn't support concurrent writes", path.Base(name))
+		}
+
+		rah.writefid = fid
+		rah.writebuf = []byte{}
+		return nil
+	}
+
+	if rah.content != nil || rah.id == 0 {
+		return nil
+	}
+
+	log.Printf("Downloading release asset %s of %s/%s\n", path.Base(name), owner, repo)
+	rc, redirectURL, err := uncachedClient.Repositories.DownloadReleaseAsset(context.Background(), owner, repo, rah.id)
+	if err != nil {
+		return err
+	}
+
+	if redirectURL != "" {
+		resp, err := http.Get(redirectURL)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("Downloading %s failed: %s", path.Base(name), resp.Status)
+		}
+		rc = resp.Body
+	}
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	rah.content = content
+	rah.size = int64(len(content))
+
+	return nil
+}
+
+func (rah *ReleaseAssetHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	if offset >= int64(len(rah.content)) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(len(rah.content)) {
+		return rah.content[offset:], nil
+	}
+
+	return rah.content[offset : offset+count], nil
+}
+
+func (rah *ReleaseAssetHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	if fid != rah.writefid {
+		return 0, fmt.Errorf("%s is not open for writing", path.Base(name))
+	}
+
+	end := int(offset) + len(buf)
+	if end > len(rah.writebuf) {
+		rah.writebuf = append(rah.writebuf, make([]byte, end-len(rah.writebuf))...)
+	}
+	copy(rah.writebuf[offset:], buf)
+
+	return int64(len(buf)), nil
+}
+
+func (rah *ReleaseAssetHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a release asset is not supported")
+}
+
+func (rah *ReleaseAssetHandler) Stat(name string) (protocol.Dir, error) {
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(rah.size), Mtime: unixTime(rah.mtime)}, nil
+}
+
+func (rah *ReleaseAssetHandler) Wstat(name string, dir protocol.Dir) error {
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	// Only truncating is supported, other changes are ignored
+	if rah.writefid != 0 && dir.Length != ^uint64(0) && int(dir.Length) < len(rah.writebuf) {
+		rah.writebuf = rah.writebuf[:dir.Length]
+	}
+	return nil
+}
+
+func (rah *ReleaseAssetHandler) Remove(name string) error {
+	owner, repo, _ := splitReleasePath(name)
+
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	// An asset that was never uploaded only needs to be forgotten
+	if rah.id == 0 {
+		return nil
+	}
+
+	log.Printf("Deleting release asset %s of %s/%s\n", path.Base(name), owner, repo)
+	_, err := client.Repositories.DeleteReleaseAsset(context.Background(), owner, repo, rah.id)
+	if err != nil {
+		return err
+	}
+	rah.id = 0
+
+	return nil
+}
+
+func (rah *ReleaseAssetHandler) Clunk(name string, fid protocol.FID) error {
+	owner, repo, tag := splitReleasePath(name)
+
+	rah.mu.Lock()
+	defer rah.mu.Unlock()
+
+	if fid != rah.writefid {
+		return nil
+	}
+	rah.writefid = 0
+
+	// Nothing was written so nothing is uploaded
+	if len(rah.writebuf) == 0 {
+		return nil
+	}
+	content := rah.writebuf
+
+	release, err := releaseByTag(owner, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	// Assets can't be overwritten so a replacement is uploaded under
+	//  another name and only takes the name of the old asset once
+	//  the old one is deleted
+	assetName := path.Base(name)
+	uploadName := assetName
+	if rah.id != 0 {
+		uploadName = fmt.Sprintf(".%s.%d.upload", assetName, time.Now().UnixNano())
+	}
+
+	mediaType := mime.TypeByExtension(path.Ext(name))
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	u := fmt.Sprintf("repos/%s/%s/releases/%d/assets?name=%s", owner, repo, release.GetID(), url.QueryEscape(uploadName))
+	req, err := client.NewUploadRequest(u, bytes.NewReader(content), int64(len(content)), mediaType)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Uploading release asset %s of %s/%s\n", uploadName, owner, repo)
+	asset := &github.ReleaseAsset{}
+	_, err = client.Do(context.Background(), req, asset)
+	if err != nil {
+		return err
+	}
+
+	if uploadName != assetName {
+		log.Printf("Deleting release asset %s of %s/%s\n", assetName, owner, repo)
+		_, err = client.Repositories.DeleteReleaseAsset(context.Background(), owner, repo, rah.id)
+		if err != nil {
+			// The old asset is still there so the upload is dropped
+			client.Repositories.DeleteReleaseAsset(context.Background(), owner, repo, asset.GetID())
+			return err
+		}
+		rah.id = 0
+
+		log.Printf("Renaming release asset %s of %s/%s to %s\n", uploadName, owner, repo, assetName)
+		renamed, _, err := client.Repositories.EditReleaseAsset(context.Background(), owner, repo, asset.GetID(), &github.ReleaseAsset{Name: &assetName})
+		if err != nil {
+			rah.id = asset.GetID()
+			return fmt.Errorf("%s was uploaded as %s but couldn't be renamed: %v", assetName, uploadName, err)
+		}
+		asset = renamed
+	}
+
+	rah.id = asset.GetID()
+	rah.size = int64(len(content))
+	rah.mtime = asset.GetUpdatedAt().Time
+	rah.content = content
+	rah.writebuf = nil
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+func TestNewReleaseForm(t *testing.T) {
+	nrc := &NewReleaseCtl{}
+	buf := &bytes.Buffer{}
+	err := newReleaseMarkdown.Execute(buf, nrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := bytes.Replace(buf.Bytes(), []byte("Tag = ___"), []byte("Tag = v1.0___"), 1)
+	doc = bytes.Replace(doc, []byte("Prerelease = []"), []byte("Prerelease = [x]"), 1)
+	doc = bytes.Replace(doc, []byte("GenerateNotes = []"), []byte("GenerateNotes = [x]"), 1)
+
+	form := NewReleaseForm{}
+	err = markform.Unmarshal(markform.Parse(doc), &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if form.Tag != "v1.0" || !form.Prerelease || !form.GenerateNotes || form.Draft || form.Body != "" {
+		t.Errorf("Unexpected form %+v\n%s", form, doc)
+	}
+
+	err = createRelease("owner", "repo", &NewReleaseForm{Tag: " "})
+	if err == nil {
+		t.Errorf("Expected an error for a release without a tag")
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"path"
 	"strings"
 	"sync"
@@ -12,7 +14,6 @@ import (
 
 	"github.com/Harvey-OS/ninep/protocol"
 	"github.com/google/go-github/github"
-	"github.com/russross/blackfriday/v2"
 	"github.com/sirnewton01/ghfs/dynamic"
 	"github.com/sirnewton01/ghfs/markform"
 )
@@ -22,17 +23,59 @@ var (
 		`# {{ .Repository.FullName }} {{ if .Repository.GetFork }}[{{ .Repository.GetSource.FullName }}](../../{{ .Repository.GetSource.Owner.Login }}/{{ .Repository.GetSource.Name }}/repo.md){{ end }}
 
 * {{ markform .Form "Description" }}
+* {{ markform .Form "Homepage" }}
+* {{ markform .Form "Topics" }}
 * {{ markform .Form "Starred" }}
 * {{ markform .Form "Notifications" }}
 * Created: {{ .Repository.CreatedAt.Format "2006-01-02T15:04:05Z07:00" }}
 * Watchers: {{ .Repository.WatchersCount }}
 * Stars: {{ .Repository.StargazersCount }}
 * Forks: {{ .Repository.ForksCount }}
-* Default branch: {{ .Repository.DefaultBranch }}
 * Pushed: {{ .Repository.PushedAt.Format "2006-01-02T15:04:05Z07:00" }}
-* Commit: {{ .Branch.GetCommit.SHA }} {{ .Branch.GetCommit.Commit.Author.Date.Format "2006-01-02T15:04:05Z07:00" }}
+* Commit: {{ .Branch.GetCommit.SHA }} {{ .Branch.GetCommit.Commit.Author.Date.Format "2006-01-02T15:04:05Z07:00" }} {{ .Checks.State }}{{ checks .Checks }}
 
     git clone {{ .Repository.CloneURL }}
+
+## Settings
+
+* {{ markform .Form "Visibility" }}
+* {{ markform .Form "DefaultBranch" }}
+* {{ markform .Form "HasIssues" }}
+* {{ markform .Form "HasWiki" }}
+* {{ markform .Form "HasProjects" }}
+* {{ markform .Form "MergeMethods" }}
+* {{ markform .Form "DeleteBranchOnMerge" }}
+* {{ markform .Form "Template" }}
+
+## Administration
+
+Check Fork to fork this repo into your account, Archived to archive it and make it read-only, or
+Delete to delete it for good. Type the full name of the repo, {{ .Repository.GetFullName }}, into Confirm
+and save this file for any of these to happen.
+
+* {{ markform .Form "Fork" }}
+* {{ markform .Form "Archived" }}
+* {{ markform .Form "Delete" }}
+* {{ markform .Form "Confirm" }}
+`))
+
+	newRepoMarkdown = template.Must(template.New("newRepo").Funcs(funcMap).Parse(
+		`# New repository {{ .Owner }}/{{ .Name }}
+
+This repository hasn't been created yet. Fill in its settings and save this file to create it, or
+remove this directory to leave it uncreated. Init starts the repository with a README so that it
+has a default branch, Gitignore and License are the names of templates, such as Go and mit.
+
+* {{ markform .Form "Description" }}
+* {{ markform .Form "Homepage" }}
+* {{ markform .Form "Visibility" }}
+* {{ markform .Form "HasIssues" }}
+* {{ markform .Form "HasWiki" }}
+* {{ markform .Form "HasProjects" }}
+* {{ markform .Form "Template" }}
+* {{ markform .Form "Init" }}
+* {{ markform .Form "Gitignore" }}
+* {{ markform .Form "License" }}
 `))
 
 	userMarkdown = template.Must(template.New("user").Funcs(funcMap).Parse(
@@ -70,6 +113,74 @@ var (
 `))
 )
 
+// repository is a repository with the settings that go-github
+//  doesn't have yet.
+type repository struct {
+	github.Repository
+	Visibility          *string `json:"visibility,omitempty"`
+	DeleteBranchOnMerge *bool   `json:"delete_branch_on_merge,omitempty"`
+	IsTemplate          *bool   `json:"is_template,omitempty"`
+}
+
+// repositoryPreviews are the media types of the previews that have
+//  the topics, visibility and template settings of a repository.
+const repositoryPreviews = "application/vnd.github.mercy-preview+json, application/vnd.github.nebula-preview+json, application/vnd.github.baptiste-preview+json"
+
+// getRepo reads a repository with all of its settings
+func getRepo(owner string, repo string) (*repository, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s", owner, repo), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", repositoryPreviews)
+
+	r := &repository{}
+	_, err = client.Do(context.Background(), req, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// editRepo changes the settings of a repository that are set in
+//  the edit, like Repositories.Edit does for the settings it has.
+func editRepo(owner string, repo string, edit *repository) error {
+	req, err := client.NewRequest("PATCH", fmt.Sprintf("repos/%s/%s", owner, repo), edit)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", repositoryPreviews)
+
+	_, err = client.Do(context.Background(), req, nil)
+	return err
+}
+
+// repoBranches lists the names of the branches of a repository
+func repoBranches(owner string, repo string) ([]string, error) {
+	branches := []string{}
+	options := &github.ListOptions{PerPage: 100}
+
+	for {
+		log.Printf("Listing branches for repo %s/%s\n", owner, repo)
+		bs, resp, err := client.Repositories.ListBranches(context.Background(), owner, repo, options)
+		if err != nil {
+			return branches, err
+		}
+
+		for _, b := range bs {
+			branches = append(branches, b.GetName())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	return branches, nil
+}
+
 type repoMarkdownForm struct {
 	Description string ` = ___`
 }
@@ -217,11 +328,7 @@ func (oh *OwnerHandler) refresh(owner string) error {
 
 		for _, repo := range repos {
 			log.Printf("Adding repo %v\n", *repo.Name)
-			server.AddFileEntry(path.Join("/repos", owner, *repo.Name), &dynamic.BasicDirHandler{server, nil})
-			repoPath := path.Join("/repos", owner, *repo.Name)
-			NewRepoOverviewHandler(repoPath)
-			NewIssuesHandler(repoPath)
-			NewRepoReadmeHandler(repoPath)
+			NewRepoHandlers(path.Join("/repos", owner, *repo.Name))
 		}
 
 		if resp.NextPage == 0 {
@@ -245,16 +352,261 @@ func (oh *OwnerHandler) Read(name string, fid protocol.FID, offset int64, count
 }
 
 func (oh *OwnerHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
-	return 0, fmt.Errorf("Creating repos is not supported.")
+	return 0, fmt.Errorf("Repos are created by making a new directory.")
+}
+
+// CreateDir makes the directory of a new repository with a repo.md
+//  for its settings. The repository is created when that's saved.
+func (oh *OwnerHandler) CreateDir(name string, child string) (int, error) {
+	repoPath := path.Join(name, child)
+	if server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == repoPath }) != -1 {
+		return -1, fmt.Errorf("Repository %s already exists", child)
+	}
+
+	idx := server.AddFileEntry(repoPath, &NewRepoDirHandler{dynamic.BasicDirHandler{server, nil}})
+	server.AddFileEntry(path.Join(repoPath, "repo.md"), &NewRepoCtl{readbuf: &bytes.Buffer{}})
+	return idx, nil
+}
+
+// NewRepoForm holds the settings of a repository that is created
+type NewRepoForm struct {
+	Description string ` = ___`
+	Homepage    string ` = ___`
+	Visibility  string ` = () public () private () internal`
+	HasIssues   bool   ` = []`
+	HasWiki     bool   ` = []`
+	HasProjects bool   ` = []`
+	Template    bool   ` = []`
+	Init        bool   ` = []`
+	Gitignore   string ` = ___`
+	License     string ` = ___`
+}
+
+// createRepo creates a repository in the account of the current
+//  user or in an organization with the settings in the form.
+func createRepo(owner string, name string, form *NewRepoForm) error {
+	r := &repository{Visibility: &form.Visibility, IsTemplate: &form.Template}
+	private := form.Visibility != "public"
+	r.Name = &name
+	r.Description = &form.Description
+	r.Homepage = &form.Homepage
+	r.Private = &private
+	r.HasIssues = &form.HasIssues
+	r.HasWiki = &form.HasWiki
+	r.HasProjects = &form.HasProjects
+	r.AutoInit = &form.Init
+	if form.Gitignore != "" {
+		r.GitignoreTemplate = &form.Gitignore
+	}
+	if form.License != "" {
+		r.LicenseTemplate = &form.License
+	}
+
+	// Repos of the current user aren't created in an organization
+	u := fmt.Sprintf("orgs/%s/repos", owner)
+	if owner == currentUser {
+		u = "user/repos"
+	}
+
+	req, err := client.NewRequest("POST", u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", repositoryPreviews)
+
+	log.Printf("Creating repository %s/%s\n", owner, name)
+	_, err = client.Do(context.Background(), req, nil)
+	return err
+}
+
+// NewRepoDirHandler handles the directory of a repository that
+//  hasn't been created yet. Removing it leaves the repository
+//  uncreated.
+type NewRepoDirHandler struct {
+	dynamic.BasicDirHandler
+}
+
+func (nrdh *NewRepoDirHandler) Remove(name string) error {
+	return nil
+}
+
+// NewRepoCtl handles the repo.md of a repository that hasn't been
+//  created yet. Saving it creates the repository and its directory
+//  is replaced with the one of the repository.
+type NewRepoCtl struct {
+	Owner string
+	Name  string
+	Form  NewRepoForm
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+// newRepoDefaults are the settings that a new repository starts with
+var newRepoDefaults = NewRepoForm{Visibility: "public", HasIssues: true, HasWiki: true, HasProjects: true, Init: true}
+
+func (nrc *NewRepoCtl) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the repo.md file")
+}
+
+func (nrc *NewRepoCtl) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if mode == protocol.OREAD {
+		nrc.Owner = path.Base(path.Dir(path.Dir(name)))
+		nrc.Name = path.Base(path.Dir(name))
+		nrc.Form = newRepoDefaults
+
+		buf := bytes.Buffer{}
+		err := newRepoMarkdown.Execute(&buf, nrc)
+		if err != nil {
+			return err
+		}
+		nrc.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if nrc.writefid != 0 {
+			return fmt.Errorf("New repository doesn't support concurrent writes")
+		}
+
+		nrc.writefid = fid
+		nrc.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (nrc *NewRepoCtl) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if offset >= int64(nrc.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(nrc.readbuf.Len()) {
+		return nrc.readbuf.Bytes()[offset:], nil
+	}
+
+	return nrc.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (nrc *NewRepoCtl) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if fid != nrc.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := nrc.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (nrc *NewRepoCtl) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a repo.md is not supported")
+}
+
+func (nrc *NewRepoCtl) Stat(name string) (protocol.Dir, error) {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(nrc.readbuf.Len())}, nil
+}
+
+func (nrc *NewRepoCtl) Wstat(name string, dir protocol.Dir) error {
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if nrc.writebuf != nil {
+		nrc.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (nrc *NewRepoCtl) Remove(name string) error {
+	return fmt.Errorf("Remove the directory of the new repository instead of its repo.md")
+}
+
+func (nrc *NewRepoCtl) Clunk(name string, fid protocol.FID) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	nrc.mu.Lock()
+	defer nrc.mu.Unlock()
+
+	if fid != nrc.writefid {
+		return nil
+	}
+	nrc.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(nrc.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	form := newRepoDefaults
+	err := markform.Unmarshal(markform.Parse(nrc.writebuf.Bytes()), &form)
+	if err != nil {
+		return err
+	}
+
+	err = createRepo(owner, repo, &form)
+	if err != nil {
+		return err
+	}
+
+	// The files of the repository take over its directory
+	repoPath := path.Dir(name)
+	server.RemoveFileEntry(repoPath)
+	NewRepoHandlers(repoPath)
+
+	return nil
+}
+
+// NewRepoHandlers adds the directory of a repository with all of its files
+func NewRepoHandlers(repoPath string) int {
+	idx := server.AddFileEntry(repoPath, &dynamic.BasicDirHandler{server, nil})
+	NewRepoOverviewHandler(repoPath)
+	NewIssuesHandler(repoPath)
+	NewPullsHandler(repoPath)
+	NewRepoReadmeHandler(repoPath)
+	NewTreeHandler(repoPath)
+	NewCommitCtl(repoPath)
+	NewBranchesHandler(repoPath)
+	NewCommitsHandler(repoPath)
+	NewCompareHandler(repoPath)
+	NewReleasesHandler(repoPath)
+	NewGitHandler(repoPath)
+	NewPatchesHandler(repoPath)
+	NewCollaboratorsHandler(repoPath)
+	NewMilestonesHandler(repoPath)
+	NewLabelsHandler(repoPath)
+	NewHooksHandler(path.Join(repoPath, "hooks"))
+	NewActionsHandler(repoPath)
+	return idx
+}
+
+// UserForm holds the editable fields of the 0user.md
+type UserForm struct {
+	Follow bool ` = []`
 }
 
 // UserHandler handles the displaying and updating of the
 //  0user.md for a user.
 type UserHandler struct {
 	User *github.User
-	Form struct {
-		Follow bool ` = []`
-	}
+	Form UserForm
 
 	readbuf  *bytes.Buffer
 	writefid protocol.FID
@@ -263,7 +615,9 @@ type UserHandler struct {
 }
 
 func NewUserHandler(name string) {
-	server.AddFileEntry(path.Join("/repos", name, "0user.md"), &UserHandler{readbuf: &bytes.Buffer{}})
+	handler := &UserHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join("/repos", name, "0user.md"), handler)
+	NewFormJSONHandler(path.Join("/repos", name, "0user.json"), handler)
 }
 
 func (uh *UserHandler) WalkChild(name string, child string) (int, error) {
@@ -273,23 +627,14 @@ func (uh *UserHandler) WalkChild(name string, child string) (int, error) {
 func (uh *UserHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
 	username := path.Base(path.Dir(name))
 
-	log.Printf("Reading user %s\n", username)
-	u, _, err := client.Users.Get(context.Background(), username)
-	if err != nil {
-		return err
-	}
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
 
-	following, _, err := client.Users.IsFollowing(context.Background(), "", username)
+	err := uh.load(username)
 	if err != nil {
 		return err
 	}
 
-	uh.mu.Lock()
-	defer uh.mu.Unlock()
-
-	uh.User = u
-	uh.Form.Follow = following
-
 	if mode == protocol.OREAD {
 		buf := bytes.Buffer{}
 		err = userMarkdown.Execute(&buf, uh)
@@ -311,6 +656,45 @@ func (uh *UserHandler) Open(name string, fid protocol.FID, mode protocol.Mode) e
 	return nil
 }
 
+func (uh *UserHandler) load(username string) error {
+	log.Printf("Reading user %s\n", username)
+	u, _, err := client.Users.Get(context.Background(), username)
+	if err != nil {
+		return err
+	}
+
+	following, _, err := client.Users.IsFollowing(context.Background(), "", username)
+	if err != nil {
+		return err
+	}
+
+	uh.User = u
+	uh.Form.Follow = following
+
+	return nil
+}
+
+func (uh *UserHandler) loadForm(name string) (interface{}, error) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	err := uh.load(path.Base(path.Dir(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	form := uh.Form
+	return &form, nil
+}
+
+func (uh *UserHandler) saveForm(name string, edited interface{}) error {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	form := edited.(*UserForm)
+	return uh.save(path.Base(path.Dir(name)), markform.Compare(&uh.Form, form), form)
+}
+
 func (uh *UserHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
 	uh.mu.Lock()
 	defer uh.mu.Unlock()
@@ -383,16 +767,20 @@ func (uh *UserHandler) Clunk(name string, fid protocol.FID) error {
 		return nil
 	}
 
-	newuh := &UserHandler{}
-	md := blackfriday.New()
-	tree := md.Parse(uh.writebuf.Bytes())
-	err := markform.Unmarshal(tree, &newuh.Form)
+	form := &UserForm{}
+	tree := markform.Parse(uh.writebuf.Bytes())
+	changes, err := markform.Diff(&uh.Form, tree, form)
 	if err != nil {
 		return err
 	}
 
-	if newuh.Form.Follow != uh.Form.Follow {
-		if newuh.Form.Follow {
+	return uh.save(username, changes, form)
+}
+
+// save applies the changes of the edited form to the user
+func (uh *UserHandler) save(username string, changes markform.Changes, form *UserForm) error {
+	if changes.Has("Follow") {
+		if form.Follow {
 			log.Printf("Following %s\n", username)
 			_, err := client.Users.Follow(context.Background(), username)
 			if err != nil {
@@ -407,11 +795,14 @@ func (uh *UserHandler) Clunk(name string, fid protocol.FID) error {
 		}
 	}
 
+	uh.Form = *form
+
 	return nil
 }
 
 func NewOrgHandler(name string) {
 	server.AddFileEntry(path.Join("/repos", name, "0org.md"), &OrgHandler{StaticFileHandler: dynamic.StaticFileHandler{[]byte{}}})
+	NewHooksHandler(path.Join("/repos", name, "0hooks"))
 }
 
 // UserHandler handles the displaying and updating of the
@@ -445,16 +836,48 @@ func (oh *OrgHandler) Open(name string, fid protocol.FID, mode protocol.Mode) er
 	return oh.StaticFileHandler.Open(name, fid, mode)
 }
 
+// RepoOverviewForm holds the editable fields of the repo.md
+//  Forking, archiving and deleting the repo need the full name of
+//  the repo in Confirm.
+type RepoOverviewForm struct {
+	Description         string   ` = ___`
+	Homepage            string   ` = ___`
+	Topics              []string ` = ,, ___`
+	Starred             bool     ` = []`
+	Notifications       string   ` = () not watching () watching () ignoring`
+	Visibility          string   ` = () public () private () internal`
+	DefaultBranch       string   ` = () ...`
+	HasIssues           bool     ` = []`
+	HasWiki             bool     ` = []`
+	HasProjects         bool     ` = []`
+	MergeMethods        []string ` = [] merge [] squash [] rebase`
+	DeleteBranchOnMerge bool     ` = []`
+	Template            bool     ` = []`
+	Fork                bool     ` = []`
+	Archived            bool     ` = []`
+	Delete              bool     ` = []`
+	Confirm             string   ` = ___`
+
+	branches []string
+}
+
+func (f RepoOverviewForm) Options(fn string) []string {
+	if fn == "DefaultBranch" {
+		if f.branches == nil {
+			return []string{}
+		}
+		return f.branches
+	}
+	return nil
+}
+
 // RepoOverviewHandler handles the displaying and updating of the
 //  repo.md for a repo.
 type RepoOverviewHandler struct {
-	Repository *github.Repository
+	Repository *repository
 	Branch     *github.Branch
-	Form       struct {
-		Description   string ` = ___`
-		Starred       bool   ` = []`
-		Notifications string ` = () not watching () watching () ignoring`
-	}
+	Checks     *commitChecks
+	Form       RepoOverviewForm
 
 	readbuf  *bytes.Buffer
 	writefid protocol.FID
@@ -463,7 +886,9 @@ type RepoOverviewHandler struct {
 }
 
 func NewRepoOverviewHandler(repoPath string) {
-	server.AddFileEntry(path.Join(repoPath, "repo.md"), &RepoOverviewHandler{readbuf: &bytes.Buffer{}})
+	handler := &RepoOverviewHandler{readbuf: &bytes.Buffer{}}
+	server.AddFileEntry(path.Join(repoPath, "repo.md"), handler)
+	NewFormJSONHandler(path.Join(repoPath, "repo.json"), handler)
 }
 
 func (roh *RepoOverviewHandler) WalkChild(name string, child string) (int, error) {
@@ -474,12 +899,41 @@ func (roh *RepoOverviewHandler) Open(name string, fid protocol.FID, mode protoco
 	owner := path.Base(path.Dir(path.Dir(name)))
 	repo := path.Base(path.Dir(name))
 
-	log.Printf("Reading repository %s/%s\n", owner, repo)
-
 	roh.mu.Lock()
 	defer roh.mu.Unlock()
 
-	r, _, err := client.Repositories.Get(context.Background(), owner, repo)
+	err := roh.load(owner, repo)
+	if err != nil {
+		return err
+	}
+
+	if mode == protocol.OREAD {
+		roh.Checks = loadChecksForDisplay(owner, repo, roh.Branch.GetCommit().GetSHA())
+
+		buf := bytes.Buffer{}
+		err = repoMarkdown.Execute(&buf, roh)
+		if err != nil {
+			return err
+		}
+		roh.readbuf = &buf
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if roh.writefid != 0 {
+			return fmt.Errorf("Repo metadata doesn't support concurrent writes")
+		}
+
+		roh.writefid = fid
+		roh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (roh *RepoOverviewHandler) load(owner string, repo string) error {
+	log.Printf("Reading repository %s/%s\n", owner, repo)
+
+	r, err := getRepo(owner, repo)
 	if err != nil {
 		return err
 	}
@@ -489,6 +943,11 @@ func (roh *RepoOverviewHandler) Open(name string, fid protocol.FID, mode protoco
 		return err
 	}
 
+	branches, err := repoBranches(owner, repo)
+	if err != nil {
+		return err
+	}
+
 	s, _, err := client.Activity.IsStarred(context.Background(), owner, repo)
 	if err != nil {
 		return err
@@ -505,7 +964,39 @@ func (roh *RepoOverviewHandler) Open(name string, fid protocol.FID, mode protoco
 	if r.Description != nil {
 		roh.Form.Description = *r.Description
 	}
+	roh.Form.Homepage = r.GetHomepage()
+	roh.Form.Topics = r.Topics
+	if roh.Form.Topics == nil {
+		roh.Form.Topics = []string{}
+	}
+	roh.Form.Visibility = "public"
+	if r.Visibility != nil {
+		roh.Form.Visibility = *r.Visibility
+	} else if r.GetPrivate() {
+		roh.Form.Visibility = "private"
+	}
+	roh.Form.branches = branches
+	roh.Form.DefaultBranch = r.GetDefaultBranch()
+	roh.Form.HasIssues = r.GetHasIssues()
+	roh.Form.HasWiki = r.GetHasWiki()
+	roh.Form.HasProjects = r.GetHasProjects()
+	roh.Form.MergeMethods = []string{}
+	if r.GetAllowMergeCommit() {
+		roh.Form.MergeMethods = append(roh.Form.MergeMethods, "merge")
+	}
+	if r.GetAllowSquashMerge() {
+		roh.Form.MergeMethods = append(roh.Form.MergeMethods, "squash")
+	}
+	if r.GetAllowRebaseMerge() {
+		roh.Form.MergeMethods = append(roh.Form.MergeMethods, "rebase")
+	}
+	roh.Form.DeleteBranchOnMerge = r.DeleteBranchOnMerge != nil && *r.DeleteBranchOnMerge
+	roh.Form.Template = r.IsTemplate != nil && *r.IsTemplate
 	roh.Form.Starred = s
+	roh.Form.Archived = r.GetArchived()
+	roh.Form.Fork = false
+	roh.Form.Delete = false
+	roh.Form.Confirm = ""
 	if subs == nil || (!*subs.Subscribed && !*subs.Ignored) {
 		roh.Form.Notifications = "not watching"
 	} else if *subs.Subscribed {
@@ -514,25 +1005,34 @@ func (roh *RepoOverviewHandler) Open(name string, fid protocol.FID, mode protoco
 		roh.Form.Notifications = "ignoring"
 	}
 
-	if mode == protocol.OREAD {
-		buf := bytes.Buffer{}
-		err = repoMarkdown.Execute(&buf, roh)
-		if err != nil {
-			return err
-		}
-		roh.readbuf = &buf
-	}
+	return nil
+}
 
-	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
-		if roh.writefid != 0 {
-			return fmt.Errorf("Repo metadata doesn't support concurrent writes")
-		}
+func (roh *RepoOverviewHandler) loadForm(name string) (interface{}, error) {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
 
-		roh.writefid = fid
-		roh.writebuf = &bytes.Buffer{}
+	roh.mu.Lock()
+	defer roh.mu.Unlock()
+
+	err := roh.load(owner, repo)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	form := roh.Form
+	return &form, nil
+}
+
+func (roh *RepoOverviewHandler) saveForm(name string, edited interface{}) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	roh.mu.Lock()
+	defer roh.mu.Unlock()
+
+	form := edited.(*RepoOverviewForm)
+	return roh.save(owner, repo, markform.Compare(&roh.Form, form), form)
 }
 
 func (roh *RepoOverviewHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
@@ -608,25 +1108,157 @@ func (roh *RepoOverviewHandler) Clunk(name string, fid protocol.FID) error {
 		return nil
 	}
 
-	newroh := &RepoOverviewHandler{}
-	md := blackfriday.New()
-	tree := md.Parse(roh.writebuf.Bytes())
-	err := markform.Unmarshal(tree, &newroh.Form)
+	form := &RepoOverviewForm{}
+	tree := markform.Parse(roh.writebuf.Bytes())
+	changes, err := markform.Diff(&roh.Form, tree, form)
 	if err != nil {
 		return err
 	}
 
-	if newroh.Form.Description != roh.Form.Description {
-		roh.Repository.Description = &newroh.Form.Description
-		log.Printf("Setting repository description for %s\n", repo)
-		_, _, err := client.Repositories.Edit(context.Background(), owner, repo, roh.Repository)
+	return roh.save(owner, repo, changes, form)
+}
+
+// createFork forks a repository into the account of the current user.
+//  GitHub accepts the fork before it is made and go-github drops the
+//  fork that it responds with in that case, so the request is sent
+//  directly to keep it.
+func createFork(owner string, repo string) (*github.Repository, error) {
+	req, err := uncachedClient.NewRequest("POST", fmt.Sprintf("repos/%s/%s/forks", owner, repo), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Forking repository %s/%s\n", owner, repo)
+	resp, err := apiTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		err = github.CheckResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fork := &github.Repository{}
+	err = json.NewDecoder(resp.Body).Decode(fork)
+	if err != nil {
+		return nil, err
+	}
+	if fork.GetOwner().GetLogin() == "" || fork.GetName() == "" {
+		return nil, fmt.Errorf("GitHub didn't say where the fork of %s/%s is", owner, repo)
+	}
+
+	return fork, nil
+}
+
+// save applies the changes of the edited form to the repository
+func (roh *RepoOverviewHandler) save(owner string, repo string, changes markform.Changes, form *RepoOverviewForm) error {
+	for _, c := range changes {
+		if c.Field != "Confirm" {
+			log.Printf("Changing %s of repository %s from %v to %v\n", c.Field, repo, c.Old, c.New)
+		}
+	}
+
+	fullName := owner + "/" + repo
+	if (changes.Has("Fork") || changes.Has("Archived") || changes.Has("Delete")) && strings.TrimSpace(form.Confirm) != fullName {
+		return fmt.Errorf("Type %s into Confirm to fork, archive or delete the repo", fullName)
+	}
+
+	if changes.Has("Delete") && form.Delete {
+		log.Printf("Deleting repository %s\n", fullName)
+		_, err := client.Repositories.Delete(context.Background(), owner, repo)
+		if err != nil {
+			return err
+		}
+
+		server.RemoveFileEntry(path.Join("/repos", owner, repo))
+		return nil
+	}
+
+	if changes.Has("Fork") && form.Fork {
+		fork, err := createFork(owner, repo)
+		if err != nil {
+			return err
+		}
+
+		// GitHub makes the fork in the background, it may have another
+		//  name if the account already has a repository with this one
+		NewRepoHandlers(path.Join("/repos", fork.GetOwner().GetLogin(), fork.GetName()))
+	}
+
+	// The settings are all changed at once
+	edit := &repository{}
+	if changes.Has("Description") {
+		edit.Description = &form.Description
+	}
+	if changes.Has("Homepage") {
+		edit.Homepage = &form.Homepage
+	}
+	if changes.Has("Visibility") {
+		edit.Visibility = &form.Visibility
+	}
+	if changes.Has("DefaultBranch") {
+		edit.DefaultBranch = &form.DefaultBranch
+	}
+	if changes.Has("HasIssues") {
+		edit.HasIssues = &form.HasIssues
+	}
+	if changes.Has("HasWiki") {
+		edit.HasWiki = &form.HasWiki
+	}
+	if changes.Has("HasProjects") {
+		edit.HasProjects = &form.HasProjects
+	}
+	if changes.Has("MergeMethods") {
+		if len(form.MergeMethods) == 0 {
+			return fmt.Errorf("At least one of the MergeMethods must be allowed")
+		}
+
+		allowed := map[string]bool{}
+		for _, m := range form.MergeMethods {
+			allowed[m] = true
+		}
+		merge, squash, rebase := allowed["merge"], allowed["squash"], allowed["rebase"]
+		edit.AllowMergeCommit = &merge
+		edit.AllowSquashMerge = &squash
+		edit.AllowRebaseMerge = &rebase
+	}
+	if changes.Has("DeleteBranchOnMerge") {
+		edit.DeleteBranchOnMerge = &form.DeleteBranchOnMerge
+	}
+	if changes.Has("Template") {
+		edit.IsTemplate = &form.Template
+	}
+	if changes.Has("Archived") {
+		edit.Archived = &form.Archived
+	}
+
+	settings := false
+	for _, fn := range []string{"Description", "Homepage", "Visibility", "DefaultBranch", "HasIssues", "HasWiki", "HasProjects", "MergeMethods", "DeleteBranchOnMerge", "Template", "Archived"} {
+		settings = settings || changes.Has(fn)
+	}
+	if settings {
+		log.Printf("Editing repository %s\n", repo)
+		err := editRepo(owner, repo, edit)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Topics can't be changed by editing the repository
+	if changes.Has("Topics") {
+		log.Printf("Setting the topics of repository %s\n", repo)
+		_, _, err := client.Repositories.ReplaceAllTopics(context.Background(), owner, repo, form.Topics)
 		if err != nil {
 			return err
 		}
 	}
 
-	if newroh.Form.Starred != roh.Form.Starred {
-		if newroh.Form.Starred {
+	if changes.Has("Starred") {
+		if form.Starred {
 			log.Printf("Starring repository %s\n", repo)
 			_, err := client.Activity.Star(context.Background(), owner, repo)
 			if err != nil {
@@ -645,9 +1277,9 @@ func (roh *RepoOverviewHandler) Clunk(name string, fid protocol.FID) error {
 	f := false
 	t := true
 
-	if newroh.Form.Notifications != roh.Form.Notifications {
+	if changes.Has("Notifications") {
 		log.Printf("Changing repository subscription for %s\n", repo)
-		if newroh.Form.Notifications == "not watching" {
+		if form.Notifications == "not watching" {
 			subs.Subscribed = &f
 			subs.Ignored = &f
 			_, _, err := client.Activity.SetRepositorySubscription(context.Background(), owner, repo, subs)
@@ -659,14 +1291,14 @@ func (roh *RepoOverviewHandler) Clunk(name string, fid protocol.FID) error {
 			if err != nil {
 				return err
 			}
-		} else if newroh.Form.Notifications == "watching" {
+		} else if form.Notifications == "watching" {
 			subs.Subscribed = &t
 			subs.Ignored = &f
 			_, _, err := client.Activity.SetRepositorySubscription(context.Background(), owner, repo, subs)
 			if err != nil {
 				return err
 			}
-		} else if newroh.Form.Notifications == "ignoring" {
+		} else if form.Notifications == "ignoring" {
 			subs.Subscribed = &f
 			subs.Ignored = &t
 			_, _, err := client.Activity.SetRepositorySubscription(context.Background(), owner, repo, subs)
@@ -676,6 +1308,10 @@ func (roh *RepoOverviewHandler) Clunk(name string, fid protocol.FID) error {
 		}
 	}
 
+	roh.Form = *form
+	roh.Form.Fork = false
+	roh.Form.Confirm = ""
+
 	return nil
 }
 
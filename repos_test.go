@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCreateFork(t *testing.T) {
+	responses := map[string]struct {
+		status int
+		body   string
+	}{
+		"/repos/owner/renamed/forks": {http.StatusAccepted, `{"name": "renamed-1", "owner": {"login": "me"}}`},
+		"/repos/owner/missing/forks": {http.StatusNotFound, `{"message": "Not Found"}`},
+		"/repos/owner/empty/forks":   {http.StatusAccepted, `{}`},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.URL.Path]
+		if !ok || r.Method != "POST" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	defer ts.Close()
+
+	saved := uncachedClient
+	defer func() { uncachedClient = saved }()
+	uncachedClient = github.NewClient(nil)
+	uncachedClient.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	fork, err := createFork("owner", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.GetOwner().GetLogin() != "me" || fork.GetName() != "renamed-1" {
+		t.Errorf("Unexpected fork %s/%s", fork.GetOwner().GetLogin(), fork.GetName())
+	}
+
+	_, err = createFork("owner", "missing")
+	if err == nil {
+		t.Errorf("Expected an error for a missing repository")
+	}
+
+	_, err = createFork("owner", "empty")
+	if err == nil {
+		t.Errorf("Expected an error for a fork without a name")
+	}
+}
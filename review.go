@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+var (
+	reviewHeaderMarkdown = template.Must(template.New("reviewHeader").Funcs(funcMap).Parse(
+		`# Review of pull request {{ .Number }}
+
+The diff of the pull request is below with the review comments quoted under the lines that they
+are about. To comment on a line add a multi-line Comment block right after it, starting with a
+line that is "Comment = <<<EOF" and ending with a line that is "EOF". Leave the lines of the diff
+as they are. Choose how to submit the review at the end and save the file to submit all of the
+comments as one review.
+
+## Diff
+
+`))
+
+	reviewFooterMarkdown = template.Must(template.New("reviewFooter").Funcs(funcMap).Parse(
+		`
+## Submit
+{{ if .Outdated }}
+These comments are about lines that are no longer in the diff.
+
+{{ range .Outdated }}> {{ .User.GetLogin }} on {{ .GetPath }}: {{ .GetBody }}
+{{ end }}{{ end }}
+* {{ markform .Form "Event" }}
+
+{{ markform .Form "Body" }}
+
+`))
+
+	reviewCommentPattern = regexp.MustCompile(`^Comment = <<<(\w+)\s*$`)
+)
+
+// reviewEvents are the API events for the ways to submit a review
+var reviewEvents = map[string]string{"comment": "COMMENT", "approve": "APPROVE", "request changes": "REQUEST_CHANGES"}
+
+// diffLine is a line of a pull request's diff with the path of its
+//  file and its position for review comments. Positions count the
+//  lines after the first hunk header of each file, the lines before
+//  that can't be commented on and have position zero. The headers of
+//  the later hunks are counted but can't be commented on either.
+type diffLine struct {
+	Text     string
+	Path     string
+	Position int
+}
+
+// parseDiff splits a unified diff into lines with their positions
+func parseDiff(diff string) []diffLine {
+	lines := []diffLine{}
+	p := ""
+	position := -1
+
+	for _, text := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if strings.HasPrefix(text, "diff --git ") {
+			position = -1
+			// Renamed and binary files have no ---/+++ lines
+			if idx := strings.Index(text, " b/"); idx != -1 {
+				p = text[idx+3:]
+			}
+		} else if position == -1 && strings.HasPrefix(text, "+++ b/") {
+			p = strings.TrimPrefix(text, "+++ b/")
+		} else if position == -1 && strings.HasPrefix(text, "--- a/") && p == "" {
+			p = strings.TrimPrefix(text, "--- a/")
+		}
+
+		if position == -1 && strings.HasPrefix(text, "@@") {
+			position = 0
+			lines = append(lines, diffLine{Text: text, Path: p})
+			continue
+		}
+
+		if position >= 0 {
+			position++
+			lines = append(lines, diffLine{Text: text, Path: p, Position: position})
+		} else {
+			lines = append(lines, diffLine{Text: text, Path: p})
+		}
+	}
+
+	return lines
+}
+
+// ReviewForm holds the way to submit a review and its summary
+type ReviewForm struct {
+	Event string ` = () ...`
+	Body  string ` = <<<`
+}
+
+func (f ReviewForm) Options(fn string) []string {
+	if fn == "Event" {
+		return []string{"comment", "approve", "request changes"}
+	}
+	return nil
+}
+
+// PullReview handles the N.review of a pull request, which is its
+//  diff with the review threads interleaved. Saving it submits the
+//  new comments and the summary as a single review.
+type PullReview struct {
+	Number   int
+	Outdated []*github.PullRequestComment
+	Form     ReviewForm
+
+	lines    []diffLine
+	commitID string
+	mtime    time.Time
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mutex    sync.Mutex
+}
+
+func (pr *PullReview) load(owner string, repo string, n int) error {
+	log.Printf("Loading pull request %d\n", n)
+	pull, _, err := uncachedClient.PullRequests.Get(context.Background(), owner, repo, n)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reading the diff of pull request %d\n", n)
+	diff, _, err := uncachedClient.PullRequests.GetRaw(context.Background(), owner, repo, n, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return err
+	}
+
+	threads := map[string][]*github.PullRequestComment{}
+	pr.Outdated = []*github.PullRequestComment{}
+	options := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		log.Printf("Listing review comments for pull request %d\n", n)
+		comments, resp, err := uncachedClient.PullRequests.ListComments(context.Background(), owner, repo, n, options)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range comments {
+			if c.Position == nil {
+				pr.Outdated = append(pr.Outdated, c)
+				continue
+			}
+			key := fmt.Sprintf("%s:%d", c.GetPath(), c.GetPosition())
+			threads[key] = append(threads[key], c)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	pr.Number = n
+	pr.commitID = pull.Head.GetSHA()
+	pr.mtime = pull.GetUpdatedAt()
+	pr.lines = parseDiff(diff)
+	pr.Form = ReviewForm{}
+
+	buf := &bytes.Buffer{}
+	err = reviewHeaderMarkdown.Execute(buf, pr)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range pr.lines {
+		buf.WriteString("    " + line.Text + "\n")
+		if line.Position == 0 {
+			continue
+		}
+		for _, c := range threads[fmt.Sprintf("%s:%d", line.Path, line.Position)] {
+			fmt.Fprintf(buf, "> %s %s\n", c.User.GetLogin(), c.GetCreatedAt().Format("2006-01-02T15:04:05Z07:00"))
+			for _, l := range strings.Split(c.GetBody(), "\n") {
+				buf.WriteString("> " + l + "\n")
+			}
+		}
+	}
+
+	err = reviewFooterMarkdown.Execute(buf, pr)
+	if err != nil {
+		return err
+	}
+	pr.readbuf = buf
+
+	return nil
+}
+
+// parse splits a written review into the new comments, which are
+//  checked against the lines of the diff, and the review form.
+func (pr *PullReview) parse(doc []byte) ([]*github.DraftReviewComment, *ReviewForm, error) {
+	comments := []*github.DraftReviewComment{}
+	rest := []string{}
+	section := ""
+	idx := -1
+
+	lines := strings.Split(string(doc), "\n")
+	for l := 0; l < len(lines); l++ {
+		line := lines[l]
+
+		if strings.HasPrefix(line, "## ") {
+			section = strings.TrimSpace(line[3:])
+			rest = append(rest, line)
+			continue
+		}
+
+		if section != "Diff" {
+			rest = append(rest, line)
+			continue
+		}
+
+		if m := reviewCommentPattern.FindStringSubmatch(line); m != nil {
+			start := l
+			body := []string{}
+			for l++; l < len(lines) && strings.TrimSpace(lines[l]) != m[1]; l++ {
+				body = append(body, lines[l])
+			}
+			if l == len(lines) {
+				return nil, nil, fmt.Errorf("Unterminated comment on line %d of the review", start+1)
+			}
+
+			text := strings.Join(body, "\n")
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if idx == -1 || pr.lines[idx].Position == 0 || strings.HasPrefix(pr.lines[idx].Text, "@@") {
+				return nil, nil, fmt.Errorf("The comment on line %d of the review isn't under a line of the diff that can be commented on", start+1)
+			}
+			p := pr.lines[idx].Path
+			position := pr.lines[idx].Position
+			comments = append(comments, &github.DraftReviewComment{Path: &p, Position: &position, Body: &text})
+			continue
+		}
+
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+
+		// Editors may strip the spaces of blank lines in the diff
+		if strings.TrimSpace(line) == "" {
+			if idx+1 < len(pr.lines) && strings.TrimSpace(pr.lines[idx+1].Text) == "" {
+				idx++
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(line, "    ") || idx+1 >= len(pr.lines) || strings.TrimRight(line[4:], " \t") != strings.TrimRight(pr.lines[idx+1].Text, " \t") {
+			return nil, nil, fmt.Errorf("Line %d of the review isn't part of the diff, comments are added in Comment blocks", l+1)
+		}
+		idx++
+	}
+
+	if idx+1 != len(pr.lines) {
+		return nil, nil, fmt.Errorf("Lines of the diff are missing from the review, open it again and add your comments")
+	}
+
+	form := &ReviewForm{}
+	err := markform.Unmarshal(markform.Parse([]byte(strings.Join(rest, "\n"))), form)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return comments, form, nil
+}
+
+// submit submits the comments and summary as a single review
+func (pr *PullReview) submit(owner string, repo string, n int, comments []*github.DraftReviewComment, form *ReviewForm) error {
+	if len(comments) == 0 && form.Event == "" && strings.TrimSpace(form.Body) == "" {
+		return nil
+	}
+
+	if form.Event == "" {
+		return fmt.Errorf("Choose whether to comment, approve or request changes to submit the review")
+	}
+
+	event := reviewEvents[form.Event]
+	review := &github.PullRequestReviewRequest{CommitID: &pr.commitID, Event: &event, Comments: comments}
+	if strings.TrimSpace(form.Body) != "" {
+		review.Body = &form.Body
+	}
+
+	log.Printf("Submitting a review of pull request %d with %d comments\n", n, len(comments))
+	_, _, err := client.PullRequests.CreateReview(context.Background(), owner, repo, n, review)
+	if err != nil {
+		return err
+	}
+
+	// The review is shown with the new threads the next time
+	pr.lines = nil
+	return nil
+}
+
+func (pr *PullReview) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of pull request reviews")
+}
+
+func (pr *PullReview) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if mode == protocol.OREAD || pr.lines == nil {
+		err = pr.load(owner, repo, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if pr.writefid != 0 {
+			return fmt.Errorf("Review doesn't support concurrent writes")
+		}
+
+		pr.writefid = fid
+		pr.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (pr *PullReview) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if offset >= int64(pr.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(pr.readbuf.Len()) {
+		return pr.readbuf.Bytes()[offset:], nil
+	}
+
+	return pr.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (pr *PullReview) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if fid != pr.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := pr.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (pr *PullReview) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a pull request review is not supported")
+}
+
+func (pr *PullReview) Stat(name string) (protocol.Dir, error) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(pr.readbuf.Len()), Mtime: unixTime(pr.mtime)}, nil
+}
+
+func (pr *PullReview) Wstat(name string, dir protocol.Dir) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if pr.writebuf != nil {
+		pr.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (pr *PullReview) Remove(name string) error {
+	return fmt.Errorf("Removing pull request reviews isn't supported.")
+}
+
+func (pr *PullReview) Clunk(name string, fid protocol.FID) error {
+	owner, repo, n, err := splitPullPath(name)
+	if err != nil {
+		return err
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if fid != pr.writefid {
+		return nil
+	}
+	pr.writefid = 0
+
+	// No bytes were written this time, leave it alone
+	if len(pr.writebuf.Bytes()) == 0 {
+		return nil
+	}
+
+	comments, form, err := pr.parse(pr.writebuf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return pr.submit(owner, repo, n, comments, form)
+}
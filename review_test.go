@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const reviewDiff = `diff --git a/one.txt b/one.txt
+index 1111111..2222222 100644
+--- a/one.txt
++++ b/one.txt
+@@ -1,3 +1,3 @@
+ first
+-second
++2nd
+ third
+@@ -10,2 +10,3 @@ func main() {
+ tenth
++tenth and a half
+ eleventh
+diff --git a/two.txt b/two.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/two.txt
+@@ -0,0 +1,2 @@
++new
++file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 4444444..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+
+func TestParseDiff(t *testing.T) {
+	expected := []diffLine{
+		{"diff --git a/one.txt b/one.txt", "one.txt", 0},
+		{"index 1111111..2222222 100644", "one.txt", 0},
+		{"--- a/one.txt", "one.txt", 0},
+		{"+++ b/one.txt", "one.txt", 0},
+		{"@@ -1,3 +1,3 @@", "one.txt", 0},
+		{" first", "one.txt", 1},
+		{"-second", "one.txt", 2},
+		{"+2nd", "one.txt", 3},
+		{" third", "one.txt", 4},
+		{"@@ -10,2 +10,3 @@ func main() {", "one.txt", 5},
+		{" tenth", "one.txt", 6},
+		{"+tenth and a half", "one.txt", 7},
+		{" eleventh", "one.txt", 8},
+		{"diff --git a/two.txt b/two.txt", "two.txt", 0},
+		{"new file mode 100644", "two.txt", 0},
+		{"index 0000000..3333333", "two.txt", 0},
+		{"--- /dev/null", "two.txt", 0},
+		{"+++ b/two.txt", "two.txt", 0},
+		{"@@ -0,0 +1,2 @@", "two.txt", 0},
+		{"+new", "two.txt", 1},
+		{"+file", "two.txt", 2},
+		{"diff --git a/gone.txt b/gone.txt", "gone.txt", 0},
+		{"deleted file mode 100644", "gone.txt", 0},
+		{"index 4444444..0000000", "gone.txt", 0},
+		{"--- a/gone.txt", "gone.txt", 0},
+		{"+++ /dev/null", "gone.txt", 0},
+		{"@@ -1 +0,0 @@", "gone.txt", 0},
+		{"-gone", "gone.txt", 1},
+	}
+
+	lines := parseDiff(reviewDiff)
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(lines))
+	}
+
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("Line %d: expected %v, got %v", i, expected[i], line)
+		}
+	}
+}
+
+// reviewDocument writes the review of the diff with comments after
+//  the lines of the diff that are the keys of the map.
+func reviewDocument(t *testing.T, pr *PullReview, comments map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	err := reviewHeaderMarkdown.Execute(buf, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range pr.lines {
+		buf.WriteString("    " + line.Text + "\n")
+		if c, ok := comments[line.Text]; ok {
+			buf.WriteString("Comment = <<<EOF\n" + c + "\nEOF\n")
+		}
+	}
+
+	err = reviewFooterMarkdown.Execute(buf, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestPullReviewParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		comments  map[string]string
+		paths     []string
+		positions []int
+		err       bool
+	}{
+		{
+			name:      "no comments",
+			comments:  map[string]string{},
+			paths:     []string{},
+			positions: []int{},
+		},
+		{
+			name: "added, removed and context lines",
+			comments: map[string]string{
+				" first":  "context",
+				"-second": "removed",
+				"+2nd":    "added\non two lines",
+			},
+			paths:     []string{"one.txt", "one.txt", "one.txt"},
+			positions: []int{1, 2, 3},
+		},
+		{
+			name: "second hunk and other files",
+			comments: map[string]string{
+				"+tenth and a half": "second hunk",
+				"+file":             "new file",
+				"-gone":             "deleted file",
+			},
+			paths:     []string{"one.txt", "two.txt", "gone.txt"},
+			positions: []int{7, 2, 1},
+		},
+		{
+			name:     "file header",
+			comments: map[string]string{"+++ b/two.txt": "not in a hunk"},
+			err:      true,
+		},
+		{
+			name:     "first hunk header",
+			comments: map[string]string{"@@ -1,3 +1,3 @@": "not in a hunk"},
+			err:      true,
+		},
+		{
+			name:     "later hunk header",
+			comments: map[string]string{"@@ -10,2 +10,3 @@ func main() {": "not in a hunk"},
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		pr := &PullReview{Number: 1, lines: parseDiff(reviewDiff)}
+		comments, _, err := pr.parse(reviewDocument(t, pr, test.comments))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if len(comments) != len(test.positions) {
+			t.Errorf("%s: expected %d comments, got %d", test.name, len(test.positions), len(comments))
+			continue
+		}
+		for i, c := range comments {
+			if c.GetPath() != test.paths[i] || c.GetPosition() != test.positions[i] {
+				t.Errorf("%s: expected comment %d on %s at %d, got %s at %d", test.name, i, test.paths[i], test.positions[i], c.GetPath(), c.GetPosition())
+			}
+		}
+	}
+}
+
+func TestPullReviewParseEdited(t *testing.T) {
+	pr := &PullReview{Number: 1, lines: parseDiff(reviewDiff)}
+	doc := reviewDocument(t, pr, map[string]string{"+2nd": "fine"})
+
+	_, _, err := pr.parse(bytes.Replace(doc, []byte("    +2nd\n"), []byte("    +second\n"), 1))
+	if err == nil {
+		t.Errorf("Expected an error for an edited line of the diff")
+	}
+
+	_, _, err = pr.parse(bytes.Replace(doc, []byte("    -gone\n"), []byte(""), 1))
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected an error for a missing line of the diff, got %v", err)
+	}
+}
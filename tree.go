@@ -0,0 +1,670 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/google/go-github/github"
+	"github.com/sirnewton01/ghfs/dynamic"
+)
+
+// refFileName is the name of the file for a git reference. Branch
+//  names can have slashes in them, which are escaped.
+func refFileName(ref string) string {
+	return strings.Replace(ref, "/", "%2F", -1)
+}
+
+// refName is the git reference of a file named with refFileName
+func refName(fileName string) string {
+	return strings.Replace(fileName, "%2F", "/", -1)
+}
+
+// splitTreePath splits the name of a file in a repository tree
+//  into the owner, repo, branch and the path within the branch.
+func splitTreePath(name string) (owner string, repo string, branch string, p string) {
+	parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 6)
+	for len(parts) < 6 {
+		parts = append(parts, "")
+	}
+	return parts[1], parts[2], refName(parts[4]), parts[5]
+}
+
+// headCommitTime finds when the head commit of a branch was made.
+//  Files get this time when they are listed with a SHA that they
+//  didn't have before so that listing a directory doesn't need to
+//  find the last commit of every file in it.
+func headCommitTime(owner string, repo string, branch string) (time.Time, error) {
+	log.Printf("Reading the head commit of %s in %s/%s\n", branch, owner, repo)
+	b, _, err := uncachedClient.Repositories.GetBranch(context.Background(), owner, repo, branch)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return b.GetCommit().GetCommit().GetCommitter().GetDate(), nil
+}
+
+// readBlob reads the raw contents of a file by the SHA of its blob,
+//  which works for files that are too large for the contents API.
+func readBlob(owner string, repo string, p string, sha string) ([]byte, error) {
+	log.Printf("Reading blob %s of %s in %s/%s\n", sha, p, owner, repo)
+	content, _, err := client.Git.GetBlobRaw(context.Background(), owner, repo, sha)
+	return content, err
+}
+
+// unixTime is the modification time of a file in a directory entry
+func unixTime(t time.Time) uint32 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint32(t.Unix())
+}
+
+// TreeHandler handles the tree directory of a repository, which
+//  has a directory for each of the branches.
+type TreeHandler struct {
+	dynamic.BasicDirHandler
+	filter map[string]bool
+	mu     sync.Mutex
+}
+
+func NewTreeHandler(repoPath string) {
+	handler := &TreeHandler{}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	server.AddFileEntry(path.Join(repoPath, "tree"), handler)
+}
+
+func (th *TreeHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := th.BasicDirHandler.WalkChild(name, child)
+
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		owner := path.Base(path.Dir(path.Dir(name)))
+		repo := path.Base(path.Dir(name))
+
+		log.Printf("Checking if branch %s exists\n", refName(child))
+		b, _, err := client.Repositories.GetBranch(context.Background(), owner, repo, refName(child))
+		if err != nil {
+			return -1, err
+		}
+
+		idx = NewTreeDirHandler(path.Join(name, child), b.GetCommit().GetSHA(), b.GetCommit().GetCommit().GetCommitter().GetDate())
+		th.mu.Lock()
+		if th.filter != nil {
+			th.filter[path.Join(name, child)] = true
+		}
+		th.mu.Unlock()
+	}
+
+	return idx, err
+}
+
+func (th *TreeHandler) refresh(name string) error {
+	owner := path.Base(path.Dir(path.Dir(name)))
+	repo := path.Base(path.Dir(name))
+
+	filter := make(map[string]bool)
+	options := &github.ListOptions{PerPage: 100}
+
+	for {
+		log.Printf("Listing branches for repo %s/%s\n", owner, repo)
+		branches, resp, err := client.Repositories.ListBranches(context.Background(), owner, repo, options)
+		if err != nil {
+			return err
+		}
+
+		for _, branch := range branches {
+			branchPath := path.Join(name, refFileName(branch.GetName()))
+			NewTreeDirHandler(branchPath, branch.GetCommit().GetSHA(), time.Time{})
+			filter[branchPath] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	th.mu.Lock()
+	th.filter = filter
+	th.mu.Unlock()
+
+	return nil
+}
+
+func (th *TreeHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := th.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return th.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+// TreeDirHandler handles a directory within a branch of a repository
+//  loading its entries from the contents API as it is read. Files
+//  and directories that are created in it are kept until they are
+//  committed since git has no empty directories.
+type TreeDirHandler struct {
+	dynamic.BasicDirHandler
+	filter  map[string]bool
+	pending map[string]bool
+	created bool
+	sha     string
+	mtime   time.Time
+	mu      sync.Mutex
+}
+
+func NewTreeDirHandler(dirPath string, sha string, mtime time.Time) int {
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool {
+		if f.Name != dirPath {
+			return false
+		}
+
+		// Keep the existing directory up to date
+		if tdh, ok := f.Handler.(*TreeDirHandler); ok {
+			tdh.update(sha, mtime)
+		}
+		return true
+	})
+
+	if idx != -1 {
+		return idx
+	}
+
+	return newTreeDirHandler(dirPath, false, sha, mtime)
+}
+
+func newTreeDirHandler(dirPath string, created bool, sha string, mtime time.Time) int {
+	handler := &TreeDirHandler{created: created, sha: sha, mtime: mtime, pending: make(map[string]bool)}
+	handler.BasicDirHandler = dynamic.BasicDirHandler{server, func(name string) bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+
+		if handler.filter == nil {
+			return true
+		}
+		return handler.filter[name]
+	}}
+
+	return server.AddFileEntry(dirPath, handler)
+}
+
+// update changes the modification time of the directory when the
+//  SHA of its tree changes
+func (tdh *TreeDirHandler) update(sha string, mtime time.Time) {
+	tdh.mu.Lock()
+	defer tdh.mu.Unlock()
+
+	if tdh.sha != sha {
+		tdh.sha = sha
+		tdh.mtime = mtime
+	}
+}
+
+func (tdh *TreeDirHandler) WalkChild(name string, child string) (int, error) {
+	idx, err := tdh.BasicDirHandler.WalkChild(name, child)
+
+	// No hidden files are looked up since Mac probes heavily for them
+	if idx == -1 && !strings.HasPrefix(child, ".") {
+		err = tdh.refresh(name)
+		if err != nil {
+			return -1, err
+		}
+		return tdh.BasicDirHandler.WalkChild(name, child)
+	}
+
+	return idx, err
+}
+
+func (tdh *TreeDirHandler) refresh(name string) error {
+	owner, repo, branch, p := splitTreePath(name)
+
+	tdh.mu.Lock()
+	created := tdh.created
+	tdh.mu.Unlock()
+
+	log.Printf("Listing contents of %s on %s in %s/%s\n", p, branch, owner, repo)
+	_, entries, resp, err := client.Repositories.GetContents(context.Background(), owner, repo, p, &github.RepositoryContentGetOptions{Ref: branch})
+	if err != nil && !(created && resp != nil && resp.StatusCode == http.StatusNotFound) {
+		return err
+	}
+
+	// Not having the time only leaves the entries without one
+	mtime := time.Time{}
+	if len(entries) != 0 {
+		mtime, err = headCommitTime(owner, repo, branch)
+		if err != nil {
+			log.Printf("Unable to find the time of %s in %s/%s: %v\n", branch, owner, repo, err)
+		}
+	}
+
+	filter := make(map[string]bool)
+	for _, entry := range entries {
+		entryPath := path.Join(name, entry.GetName())
+		if entry.GetType() == "dir" {
+			NewTreeDirHandler(entryPath, entry.GetSHA(), mtime)
+		} else {
+			NewTreeFileHandler(entryPath, int64(entry.GetSize()), entry.GetSHA(), mtime)
+		}
+		filter[entryPath] = true
+	}
+
+	tdh.mu.Lock()
+	pending := []string{}
+	for entryPath := range tdh.pending {
+		pending = append(pending, entryPath)
+	}
+	tdh.mu.Unlock()
+
+	// Keep the created entries that aren't committed yet
+	gone := map[string]bool{}
+	for _, entryPath := range pending {
+		entryPath := entryPath
+		gone[entryPath] = filter[entryPath] || server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == entryPath }) == -1
+	}
+
+	tdh.mu.Lock()
+	defer tdh.mu.Unlock()
+
+	for entryPath, g := range gone {
+		if g {
+			delete(tdh.pending, entryPath)
+			continue
+		}
+		filter[entryPath] = true
+	}
+	if len(entries) != 0 {
+		tdh.created = false
+	}
+	// The root of a branch has no tree SHA from a parent directory
+	if p == "" && !mtime.IsZero() {
+		tdh.mtime = mtime
+	}
+	tdh.filter = filter
+
+	return nil
+}
+
+func (tdh *TreeDirHandler) CreateChild(name string, child string) (int, error) {
+	childPath := path.Join(name, child)
+
+	// Creating a file that exists opens it for writing
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx == -1 {
+		idx = server.AddFileEntry(childPath, &TreeFileHandler{})
+	}
+
+	tdh.addPending(childPath)
+	return idx, nil
+}
+
+func (tdh *TreeDirHandler) CreateDir(name string, child string) (int, error) {
+	childPath := path.Join(name, child)
+
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool { return f.Name == childPath })
+	if idx != -1 {
+		return -1, fmt.Errorf("%s already exists", child)
+	}
+
+	idx = newTreeDirHandler(childPath, true, "", time.Time{})
+	tdh.addPending(childPath)
+	return idx, nil
+}
+
+func (tdh *TreeDirHandler) addPending(childPath string) {
+	tdh.mu.Lock()
+	defer tdh.mu.Unlock()
+
+	tdh.pending[childPath] = true
+	if tdh.filter != nil {
+		tdh.filter[childPath] = true
+	}
+}
+
+func (tdh *TreeDirHandler) Remove(name string) error {
+	err := tdh.refresh(name)
+	if err != nil {
+		return err
+	}
+
+	tdh.mu.Lock()
+	defer tdh.mu.Unlock()
+
+	// Directories go away on their own when their last file is removed
+	if len(tdh.filter) != 0 {
+		return fmt.Errorf("%s is not empty", path.Base(name))
+	}
+	return nil
+}
+
+func (tdh *TreeDirHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	if offset == 0 && count > 0 {
+		err := tdh.refresh(name)
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+
+	return tdh.BasicDirHandler.Read(name, fid, offset, count)
+}
+
+func (tdh *TreeDirHandler) Stat(name string) (protocol.Dir, error) {
+	tdh.mu.Lock()
+	defer tdh.mu.Unlock()
+
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTDIR}, Mtime: unixTime(tdh.mtime)}, nil
+}
+
+// TreeFileHandler handles a file within a branch of a repository.
+//  The file is loaded when it is opened, from the contents API for
+//  small files and from the blob for large ones. Saving
+//  the file commits it to the branch. The commit is based on the
+//  version of the file that was last read so that changes made by
+//  someone else in the meantime are reported instead of overwritten.
+type TreeFileHandler struct {
+	size    int64
+	sha     string
+	mtime   time.Time
+	content []byte
+
+	writefid protocol.FID
+	writebuf []byte
+	dirty    bool
+	truncate bool
+	mu       sync.Mutex
+}
+
+func NewTreeFileHandler(filePath string, size int64, sha string, mtime time.Time) int {
+	idx := server.MatchFile(func(f *dynamic.FileEntry) bool {
+		if f.Name != filePath {
+			return false
+		}
+
+		// Keep the existing file up to date
+		if tfh, ok := f.Handler.(*TreeFileHandler); ok {
+			tfh.update(size, sha, mtime)
+		}
+		return true
+	})
+
+	if idx != -1 {
+		return idx
+	}
+
+	return server.AddFileEntry(filePath, &TreeFileHandler{size: size, sha: sha, mtime: mtime})
+}
+
+func (tfh *TreeFileHandler) update(size int64, sha string, mtime time.Time) {
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	if tfh.sha != sha && tfh.writefid == 0 {
+		tfh.size = size
+		tfh.sha = sha
+		tfh.content = nil
+		tfh.mtime = mtime
+		tfh.writebuf = nil
+	}
+}
+
+func (tfh *TreeFileHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of a file")
+}
+
+func (tfh *TreeFileHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	owner, repo, branch, p := splitTreePath(name)
+
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	// Files that were just created aren't on GitHub yet. Opening only
+	//  for writing keeps the version that was last read.
+	if tfh.sha != "" && mode&3 != protocol.OWRITE {
+		log.Printf("Getting contents of %s on %s in %s/%s\n", p, branch, owner, repo)
+		file, _, _, err := client.Repositories.GetContents(context.Background(), owner, repo, p, &github.RepositoryContentGetOptions{Ref: branch})
+		if err != nil {
+			return err
+		}
+		if file == nil {
+			return fmt.Errorf("%s is not a file", p)
+		}
+
+		// Changed since it was listed, the content of a commit that
+		//  failed is dropped since it would overwrite the change
+		if file.GetSHA() != tfh.sha {
+			tfh.writebuf = nil
+
+			mtime, err := headCommitTime(owner, repo, branch)
+			if err != nil {
+				log.Printf("Unable to find the time of %s in %s/%s: %v\n", branch, owner, repo, err)
+			}
+			tfh.mtime = mtime
+		}
+		tfh.size = int64(file.GetSize())
+		tfh.sha = file.GetSHA()
+		tfh.content = nil
+
+		// Large files don't have their content included so their
+		//  blob is read instead, once for all of the reads
+		if file.GetEncoding() == "base64" && (file.Content != nil && *file.Content != "" || tfh.size == 0) {
+			c, err := file.GetContent()
+			if err != nil {
+				return err
+			}
+			tfh.content = []byte(c)
+		} else {
+			content, err := readBlob(owner, repo, p, tfh.sha)
+			if err != nil {
+				return err
+			}
+			tfh.content = content
+		}
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if tfh.writefid != 0 {
+			return fmt.Errorf("%s doesn't support concurrent writes", p)
+		}
+
+		unsaved := tfh.writebuf
+		tfh.writefid = fid
+		tfh.writebuf = []byte{}
+		tfh.dirty = false
+
+		if mode&protocol.OTRUNC != 0 || tfh.truncate {
+			tfh.dirty = tfh.size != 0
+		} else if unsaved != nil {
+			// Pick up the content of a commit that failed
+			tfh.writebuf = unsaved
+			tfh.dirty = true
+		} else if tfh.content != nil {
+			tfh.writebuf = append(tfh.writebuf, tfh.content...)
+		} else if tfh.size != 0 {
+			content, err := readBlob(owner, repo, p, tfh.sha)
+			if err != nil {
+				tfh.writefid = 0
+				return err
+			}
+			tfh.writebuf = content
+		}
+		tfh.truncate = false
+	}
+
+	return nil
+}
+
+func (tfh *TreeFileHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of a file is not supported")
+}
+
+func (tfh *TreeFileHandler) Stat(name string) (protocol.Dir, error) {
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(tfh.size), Mtime: unixTime(tfh.mtime)}, nil
+}
+
+func (tfh *TreeFileHandler) Wstat(name string, dir protocol.Dir) error {
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	// Only truncating is supported, other changes are ignored
+	if dir.Length == ^uint64(0) {
+		return nil
+	}
+
+	if tfh.writefid == 0 {
+		// Truncated before it is opened for writing
+		if dir.Length == 0 {
+			tfh.truncate = true
+		}
+		return nil
+	}
+
+	length := int(dir.Length)
+	if length < len(tfh.writebuf) {
+		tfh.writebuf = tfh.writebuf[:length]
+	} else {
+		tfh.writebuf = append(tfh.writebuf, make([]byte, length-len(tfh.writebuf))...)
+	}
+	tfh.dirty = true
+	return nil
+}
+
+func (tfh *TreeFileHandler) Remove(name string) error {
+	owner, repo, branch, p := splitTreePath(name)
+
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	// A file that was never committed only needs to be forgotten
+	if tfh.sha == "" {
+		return nil
+	}
+
+	message, author := nextCommit(owner, repo, "Delete "+p)
+	opts := &github.RepositoryContentFileOptions{Message: message, SHA: &tfh.sha, Branch: &branch, Author: author}
+
+	log.Printf("Deleting %s on %s in %s/%s\n", p, branch, owner, repo)
+	_, resp, err := client.Repositories.DeleteFile(context.Background(), owner, repo, p, opts)
+	if err != nil {
+		return commitError(resp, err, p, branch)
+	}
+	commitMade(owner, repo, *message)
+
+	return nil
+}
+
+// commitError reports a commit that was rejected because the file
+//  was changed on the branch after it was last read.
+func commitError(resp *github.Response, err error, p string, branch string) error {
+	if resp != nil && (resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusUnprocessableEntity) {
+		return fmt.Errorf("%s has changed on %s since it was read, read it again and reapply your changes: %v", p, branch, err)
+	}
+	return err
+}
+
+func (tfh *TreeFileHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	content := tfh.content
+	if offset >= int64(len(content)) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(len(content)) {
+		return content[offset:], nil
+	}
+
+	return content[offset : offset+count], nil
+}
+
+func (tfh *TreeFileHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	if fid != tfh.writefid {
+		return 0, fmt.Errorf("%s is not open for writing", path.Base(name))
+	}
+
+	end := int(offset) + len(buf)
+	if end > len(tfh.writebuf) {
+		tfh.writebuf = append(tfh.writebuf, make([]byte, end-len(tfh.writebuf))...)
+	}
+	copy(tfh.writebuf[offset:], buf)
+	tfh.dirty = true
+
+	return int64(len(buf)), nil
+}
+
+func (tfh *TreeFileHandler) Clunk(name string, fid protocol.FID) error {
+	tfh.mu.Lock()
+	defer tfh.mu.Unlock()
+
+	if fid != tfh.writefid {
+		return nil
+	}
+	tfh.writefid = 0
+
+	// Nothing changed, so there is nothing to commit. New files
+	//  are committed once they have some content.
+	if !tfh.dirty && tfh.sha != "" || tfh.sha == "" && len(tfh.writebuf) == 0 {
+		tfh.writebuf = nil
+		return nil
+	}
+
+	// The written content is kept until it is committed so that it
+	//  is written again the next time the file is opened for writing
+	//  when the commit fails
+	owner, repo, branch, p := splitTreePath(name)
+	content := tfh.writebuf
+
+	var resp *github.Response
+	var result *github.RepositoryContentResponse
+	var message *string
+	var author *github.CommitAuthor
+	var err error
+	if tfh.sha == "" {
+		message, author = nextCommit(owner, repo, "Create "+p)
+		opts := &github.RepositoryContentFileOptions{Message: message, Content: content, Branch: &branch, Author: author}
+
+		log.Printf("Creating %s on %s in %s/%s\n", p, branch, owner, repo)
+		result, resp, err = client.Repositories.CreateFile(context.Background(), owner, repo, p, opts)
+	} else {
+		message, author = nextCommit(owner, repo, "Update "+p)
+		opts := &github.RepositoryContentFileOptions{Message: message, Content: content, SHA: &tfh.sha, Branch: &branch, Author: author}
+
+		log.Printf("Updating %s on %s in %s/%s\n", p, branch, owner, repo)
+		result, resp, err = client.Repositories.UpdateFile(context.Background(), owner, repo, p, opts)
+	}
+	if err != nil {
+		return commitError(resp, err, p, branch)
+	}
+	commitMade(owner, repo, *message)
+
+	tfh.writebuf = nil
+	tfh.sha = result.GetContent().GetSHA()
+	tfh.size = int64(len(content))
+	tfh.content = content
+	tfh.mtime = result.Commit.GetCommitter().GetDate()
+
+	return nil
+}
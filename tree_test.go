@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTreeMtime(t *testing.T) {
+	first := time.Unix(1500000000, 0)
+	later := first.Add(time.Hour)
+
+	tfh := &TreeFileHandler{size: 3, sha: "a", mtime: first}
+	tfh.update(3, "a", later)
+	if !tfh.mtime.Equal(first) {
+		t.Errorf("Expected the time to be kept for the same SHA, got %v", tfh.mtime)
+	}
+	tfh.update(4, "b", later)
+	if !tfh.mtime.Equal(later) || tfh.size != 4 {
+		t.Errorf("Expected the time and size to change with the SHA, got %v and %d", tfh.mtime, tfh.size)
+	}
+
+	tdh := &TreeDirHandler{sha: "c", mtime: first}
+	tdh.update("c", later)
+	if !tdh.mtime.Equal(first) {
+		t.Errorf("Expected the time to be kept for the same tree, got %v", tdh.mtime)
+	}
+	tdh.update("d", later)
+	if !tdh.mtime.Equal(later) {
+		t.Errorf("Expected the time to change with the tree, got %v", tdh.mtime)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Harvey-OS/ninep/protocol"
+	"github.com/sirnewton01/ghfs/markform"
+)
+
+// formEditor is implemented by the handlers of markform files so
+//  that their forms can also be read and saved in other formats.
+type formEditor interface {
+	// loadForm refreshes the handler from GitHub and returns a
+	//  pointer to a copy of its form.
+	loadForm(name string) (interface{}, error)
+	// saveForm applies the changes in the edited form using the
+	//  same path as saving the markform file.
+	saveForm(name string, edited interface{}) error
+}
+
+// FormJSONHandler handles a JSON view of a markform file, such as
+//  repo.json for repo.md. The JSON object has the same fields as the
+//  form and writing it saves the changes just like the markform file.
+//  Fields that are left out of a written object are not changed.
+type FormJSONHandler struct {
+	editor formEditor
+
+	readbuf  *bytes.Buffer
+	writefid protocol.FID
+	writebuf *bytes.Buffer
+	mu       sync.Mutex
+}
+
+func NewFormJSONHandler(jsonPath string, editor formEditor) {
+	server.AddFileEntry(jsonPath, &FormJSONHandler{editor: editor, readbuf: &bytes.Buffer{}})
+}
+
+// markformName is the name of the markform file of the view
+func (fjh *FormJSONHandler) markformName(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + ".md"
+}
+
+func (fjh *FormJSONHandler) WalkChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("No children of the %s file", path.Base(name))
+}
+
+func (fjh *FormJSONHandler) Open(name string, fid protocol.FID, mode protocol.Mode) error {
+	form, err := fjh.editor.loadForm(fjh.markformName(name))
+	if err != nil {
+		return err
+	}
+
+	fjh.mu.Lock()
+	defer fjh.mu.Unlock()
+
+	if mode == protocol.OREAD {
+		b, err := json.MarshalIndent(form, "", "  ")
+		if err != nil {
+			return err
+		}
+		fjh.readbuf = bytes.NewBuffer(append(b, '\n'))
+	}
+
+	if mode&protocol.ORDWR != 0 || mode&protocol.OWRITE != 0 {
+		if fjh.writefid != 0 {
+			return fmt.Errorf("%s doesn't support concurrent writes", path.Base(name))
+		}
+
+		fjh.writefid = fid
+		fjh.writebuf = &bytes.Buffer{}
+	}
+
+	return nil
+}
+
+func (fjh *FormJSONHandler) Write(name string, fid protocol.FID, offset int64, buf []byte) (int64, error) {
+	fjh.mu.Lock()
+	defer fjh.mu.Unlock()
+
+	if fid != fjh.writefid {
+		return int64(len(buf)), nil
+	}
+
+	// TODO consider offset
+	length, err := fjh.writebuf.Write(buf)
+	if err != nil {
+		return int64(length), err
+	}
+
+	return int64(length), nil
+}
+
+func (fjh *FormJSONHandler) Read(name string, fid protocol.FID, offset int64, count int64) ([]byte, error) {
+	fjh.mu.Lock()
+	defer fjh.mu.Unlock()
+
+	if offset >= int64(fjh.readbuf.Len()) {
+		return []byte{}, nil // TODO should an error be returned?
+	}
+
+	if offset+count >= int64(fjh.readbuf.Len()) {
+		return fjh.readbuf.Bytes()[offset:], nil
+	}
+
+	return fjh.readbuf.Bytes()[offset : offset+count], nil
+}
+
+func (fjh *FormJSONHandler) CreateChild(name string, child string) (int, error) {
+	return -1, fmt.Errorf("Creating a child of %s is not supported", path.Base(name))
+}
+
+func (fjh *FormJSONHandler) Stat(name string) (protocol.Dir, error) {
+	fjh.mu.Lock()
+	defer fjh.mu.Unlock()
+
+	// There's only one version and it is always a file
+	return protocol.Dir{QID: protocol.QID{Version: 0, Type: protocol.QTFILE}, Length: uint64(fjh.readbuf.Len())}, nil
+}
+
+func (fjh *FormJSONHandler) Wstat(name string, dir protocol.Dir) error {
+	fjh.mu.Lock()
+	defer fjh.mu.Unlock()
+
+	if fjh.writebuf != nil {
+		fjh.writebuf.Truncate(int(dir.Length))
+	}
+	return nil
+}
+
+func (fjh *FormJSONHandler) Remove(name string) error {
+	return fmt.Errorf("Removing %s isn't supported.", path.Base(name))
+}
+
+func (fjh *FormJSONHandler) Clunk(name string, fid protocol.FID) error {
+	fjh.mu.Lock()
+	if fid != fjh.writefid {
+		fjh.mu.Unlock()
+		return nil
+	}
+	fjh.writefid = 0
+	buf := fjh.writebuf.Bytes()
+	fjh.mu.Unlock()
+
+	// No bytes were written this time, leave it alone
+	if len(buf) == 0 {
+		return nil
+	}
+
+	// Start from the current values so that missing fields are unchanged
+	form, err := fjh.editor.loadForm(fjh.markformName(name))
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(buf, form)
+	if err != nil {
+		return err
+	}
+
+	// The markform file rejects options that aren't in the form
+	err = markform.Validate(form)
+	if err != nil {
+		return err
+	}
+
+	return fjh.editor.saveForm(fjh.markformName(name), form)
+}